@@ -0,0 +1,181 @@
+package datalog
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+func (a Aggregate) Eval(ctx context.Context, vars Vars, db *Database, out chan<- Vars) {
+	a.each(ctx, vars, db, sender(ctx, out))
+}
+
+func (a Aggregate) each(ctx context.Context, vars Vars, db *Database, yield func(Vars) bool) {
+	// the wildcards are replaced with variables, so that
+	// the matched facts that differ only by them are counted
+	a = a.nameWildcards(vars)
+
+	// the variables that were bound before are the grouping keys,
+	// the solutions differ by the values of the remaining ones
+	local := a.localVars()
+	seen := make(map[string]bool)
+	var (
+		mu     sync.Mutex
+		values []any
+		err    error
+	)
+	evalBody(ctx, a.Body, vars, db, func(vars Vars) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if vars.err != nil {
+			err = vars.err
+		}
+		if err != nil {
+			return false
+		}
+		var solution []any
+		for _, v := range local {
+			solution = append(solution, vars.expand(v))
+		}
+		key := fmt.Sprintf("%#v", solution)
+		if !seen[key] {
+			seen[key] = true
+			values = append(values, vars.expand(a.Term))
+		}
+		return true
+	})
+
+	if ctx.Err() != nil {
+		// the values are incomplete
+		return
+	}
+	if err != nil {
+		yield(vars.fail(err))
+		return
+	}
+
+	result, ok := aggregate(a.Func, values)
+	if !ok {
+		return
+	}
+	if vars.Unify(a.Result, result) {
+		yield(vars)
+	}
+}
+
+// Variables used in the body of the aggregate.
+func (a Aggregate) localVars() []Var {
+	var vars []Var
+	for _, lit := range a.Body {
+		switch lit := lit.(type) {
+		case Atom:
+			vars = append(vars, varsOf(lit.Args...)...)
+		case Negation:
+			vars = append(vars, varsOf(lit.Atom.Args...)...)
+		case Constraint:
+			vars = append(vars, varsOf(lit.Lhs, lit.Rhs)...)
+		case Aggregate:
+			vars = append(vars, varsOf(lit.Result)...)
+		}
+	}
+	return vars
+}
+
+// Replace the wildcards in the atoms of the body with unique variables.
+func (a Aggregate) nameWildcards(vars Vars) Aggregate {
+	var (
+		body []Evaluable
+		i    int
+	)
+	for _, lit := range a.Body {
+		if atom, ok := lit.(Atom); ok {
+			var args []any
+			for _, arg := range atom.Args {
+				if _, ok := arg.(Wildcard); ok {
+					arg = Var{Name: fmt.Sprintf("_%d", i), Counter: vars.Counter}
+					i++
+				}
+				args = append(args, arg)
+			}
+			lit = Atom{Name: atom.Name, Args: args}
+		}
+		body = append(body, lit)
+	}
+	a.Body = body
+	return a
+}
+
+// Calculate the aggregate of the values, fail if it
+// is not defined for them.
+func aggregate(fn string, values []any) (any, bool) {
+	switch fn {
+	case "count":
+		return len(values), true
+	case "sum":
+		var (
+			sum   int
+			fsum  Float
+			float bool
+		)
+		for _, val := range values {
+			switch val := val.(type) {
+			case int:
+				sum += val
+			case Float:
+				fsum += val
+				float = true
+			default:
+				return nil, false
+			}
+		}
+		if float {
+			// the sum of the Floats and the integers is a Float
+			return fsum + Float(sum), true
+		}
+		return sum, true
+	case "min":
+		return extremum(values, "<")
+	case "max":
+		return extremum(values, ">")
+	default:
+		panic(fmt.Sprintf("invalid aggregate: %s", fn))
+	}
+}
+
+// Find the value that is the smallest or largest
+// depending on the comparison operator.
+func extremum(values []any, op string) (any, bool) {
+	if len(values) == 0 {
+		return nil, false
+	}
+	best := values[0]
+	for _, val := range values {
+		if lhs, rhs, ok := asType[int](val, best); ok {
+			if compare(op, lhs, rhs) {
+				best = val
+			}
+		} else if _, _, ok := asFloats(val, best); ok {
+			// using the total order, so the result does not depend on
+			// the order of the values if the integer and the Float are equal
+			if c := Compare(val, best); (op == "<" && c < 0) || (op == ">" && c > 0) {
+				best = val
+			}
+		} else if lhs, rhs, ok := asType[String](val, best); ok {
+			if compare(op, lhs, rhs) {
+				best = val
+			}
+		} else {
+			return nil, false
+		}
+	}
+	return best, true
+}
+
+func (a Aggregate) renameVars(vars Vars) Aggregate {
+	return Aggregate{
+		Func:   a.Func,
+		Result: vars.rename(a.Result),
+		Term:   vars.rename(a.Term),
+		Body:   renameBody(a.Body, vars),
+	}
+}
@@ -0,0 +1,148 @@
+package datalog
+
+import (
+	"fmt"
+	"math"
+)
+
+// Calculate the value of the term. Variables are replaced with
+// their values, or returned as-is if they are unbound. Arithmetic
+// expressions are evaluated and need all their variables to be bound.
+func (vars Vars) Compute(term any) (any, error) {
+	switch term := term.(type) {
+	case Expr:
+		rhs, err := vars.operand(term, term.Rhs)
+		if err != nil {
+			return nil, err
+		}
+		if term.Lhs == nil {
+			switch rhs := rhs.(type) {
+			case int:
+				return -rhs, nil
+			case Float:
+				return -rhs, nil
+			}
+			return nil, fmt.Errorf("cannot apply %s to %v", term.Op, rhs)
+		}
+		lhs, err := vars.operand(term, term.Lhs)
+		if err != nil {
+			return nil, err
+		}
+		if lhs, rhs, ok := asType[int](lhs, rhs); ok {
+			return calculate(term.Op, lhs, rhs)
+		}
+		if lhs, rhs, ok := asFloats(lhs, rhs); ok {
+			return calculateFloat(term.Op, lhs, rhs)
+		}
+		return nil, fmt.Errorf("cannot apply %s to %v and %v", term.Op, lhs, rhs)
+	default:
+		return vars.expand(term), nil
+	}
+}
+
+// Compute the value of the operand of the expression.
+func (vars Vars) operand(expr Expr, term any) (any, error) {
+	val, err := vars.Compute(term)
+	if err != nil {
+		return nil, err
+	}
+	switch val.(type) {
+	case Var, Wildcard:
+		return nil, fmt.Errorf("%v is not bound in %v", val, expr)
+	}
+	return val, nil
+}
+
+func calculate(op string, lhs, rhs int) (int, error) {
+	switch op {
+	case "+":
+		return lhs + rhs, nil
+	case "-":
+		return lhs - rhs, nil
+	case "*":
+		return lhs * rhs, nil
+	case "/", "mod":
+		if rhs == 0 {
+			return 0, fmt.Errorf("division by zero: %v %s %v", lhs, op, rhs)
+		}
+		if op == "/" {
+			return lhs / rhs, nil
+		}
+		return lhs % rhs, nil
+	default:
+		panic(fmt.Sprintf("invalid operator: %s", op))
+	}
+}
+
+// The arithmetic with a Float operand gives a Float.
+func calculateFloat(op string, lhs, rhs Float) (Float, error) {
+	switch op {
+	case "+":
+		return lhs + rhs, nil
+	case "-":
+		return lhs - rhs, nil
+	case "*":
+		return lhs * rhs, nil
+	case "/", "mod":
+		if rhs == 0 {
+			return 0, fmt.Errorf("division by zero: %v %s %v", lhs, op, rhs)
+		}
+		if op == "/" {
+			return lhs / rhs, nil
+		}
+		return Float(math.Mod(float64(lhs), float64(rhs))), nil
+	default:
+		panic(fmt.Sprintf("invalid operator: %s", op))
+	}
+}
+
+// Convert the numbers to Floats, if one of them is a Float,
+// and the other one is a Float or an integer.
+func asFloats(lhs, rhs any) (Float, Float, bool) {
+	_, lok := lhs.(Float)
+	_, rok := rhs.(Float)
+	if !lok && !rok {
+		return 0, 0, false
+	}
+	l, ok := toFloat(lhs)
+	if !ok {
+		return 0, 0, false
+	}
+	r, ok := toFloat(rhs)
+	return l, r, ok
+}
+
+func toFloat(val any) (Float, bool) {
+	switch val := val.(type) {
+	case int:
+		return Float(val), true
+	case Float:
+		return val, true
+	default:
+		return 0, false
+	}
+}
+
+func (e Expr) renameVars(vars Vars) Expr {
+	var lhs any
+	if e.Lhs != nil {
+		lhs = renameTerm(e.Lhs, vars)
+	}
+	return Expr{
+		Op:  e.Op,
+		Lhs: lhs,
+		Rhs: renameTerm(e.Rhs, vars),
+	}
+}
+
+// Rename the variables in the term, including the nested ones.
+func renameTerm(term any, vars Vars) any {
+	switch term := term.(type) {
+	case Expr:
+		return term.renameVars(vars)
+	case Compound:
+		return term.renameVars(vars)
+	default:
+		return vars.rename(term)
+	}
+}
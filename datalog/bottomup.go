@@ -0,0 +1,233 @@
+package datalog
+
+import (
+	"context"
+	"fmt"
+)
+
+// Strategy used for answering the queries.
+type Strategy int
+
+const (
+	// Start from the query and recursively resolve
+	// the rules matching it.
+	TopDown Strategy = iota
+	// Derive all the facts needed to answer the query
+	// using semi-naive evaluation, then search them.
+	BottomUp
+)
+
+func (s Strategy) String() string {
+	switch s {
+	case TopDown:
+		return "topdown"
+	case BottomUp:
+		return "bottomup"
+	default:
+		return fmt.Sprintf("Strategy(%d)", int(s))
+	}
+}
+
+// Derive all the facts for the relations in the strata
+// and return them as a new database, that has no rules.
+func (db *Database) fixpoint(ctx context.Context, strata [][]Key) (*Database, error) {
+	if err := db.checkStrata(strata); err != nil {
+		return nil, err
+	}
+	store := db.emptyWithIndexes()
+	for _, stratum := range strata {
+		if err := db.evalStratum(ctx, stratum, store); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// Check if the variables are bound in all the rules for the relations in the strata.
+func (db *Database) checkStrata(strata [][]Key) error {
+	for _, stratum := range strata {
+		for _, key := range stratum {
+			for _, rule := range db.rules[key] {
+				if err := rule.checkBound(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Semi-naive evaluation of the rules for the relations in the stratum.
+// The store needs to contain all the facts for the lower strata, the
+// derived facts are saved to it.
+func (db *Database) evalStratum(ctx context.Context, stratum []Key, store *Database) error {
+	var rules []Rule
+	recursive := make(map[Key]bool)
+	for _, key := range stratum {
+		recursive[key] = true
+		for _, val := range db.clauses(key) {
+			switch val := val.(type) {
+			case Atom:
+				store.insert(val)
+			case Rule:
+				rules = append(rules, val)
+			}
+		}
+	}
+
+	// first iteration is naive, every rule sees all the facts
+	delta := db.emptyWithIndexes()
+	changed := false
+	for _, rule := range rules {
+		sources := make([]*Database, len(rule.Body))
+		for i := range sources {
+			sources[i] = store
+		}
+		err := derive(ctx, rule, sources, func(atom Atom) {
+			if !store.contains(atom) && delta.insert(atom) {
+				changed = true
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// in the following iterations, the rules need to use
+	// at least one of the facts derived in the previous one
+	for changed {
+		store.merge(delta)
+		next := db.emptyWithIndexes()
+		changed = false
+		for _, rule := range rules {
+			for i, lit := range rule.Body {
+				if atom, ok := lit.(Atom); !ok || !recursive[atom.Key()] {
+					continue
+				}
+				sources := make([]*Database, len(rule.Body))
+				for j := range sources {
+					sources[j] = store
+				}
+				sources[i] = delta
+				err := derive(ctx, rule, sources, func(atom Atom) {
+					if !store.contains(atom) && next.insert(atom) {
+						changed = true
+					}
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		delta = next
+	}
+	return nil
+}
+
+// Copy all the facts from the other database.
+func (db *Database) merge(other *Database) {
+	for key := range other.nodes {
+		for _, val := range other.clauses(key) {
+			if atom, ok := val.(Atom); ok {
+				db.insert(atom)
+			}
+		}
+	}
+}
+
+// Evaluate the body of the rule, where each literal is evaluated
+// against the corresponding source, and pass the heads materialized
+// with the matched variables to the emit function.
+// Return the first error raised during the evaluation.
+func derive(ctx context.Context, rule Rule, sources []*Database, emit func(Atom)) error {
+	return deriveFrom(ctx, rule, sources, Vars{}, emit)
+}
+
+// Derive like derive, starting from the variable substitutions.
+func deriveFrom(ctx context.Context, rule Rule, sources []*Database, vars Vars, emit func(Atom)) error {
+	// the literals are reordered using the sizes of their sources
+	order := planBody(
+		rule.Body,
+		vars.bound(rule.Body),
+		func(i int, atom Atom, bound map[Var]bool) float64 {
+			return sources[i].estimate(atom, bound)
+		},
+		func(int) bool { return false },
+	)
+	body, sources := permute(rule.Body, order), permute(sources, order)
+
+	ch := make(chan Vars)
+	go func() {
+		defer close(ch)
+		evalBodyFrom(ctx, body, sources, vars, sender(ctx, ch))
+	}()
+	var err error
+	for vars := range ch {
+		if err != nil {
+			// consume the results, so the goroutines can finish
+			continue
+		}
+		if vars.err != nil {
+			err = vars.err
+			continue
+		}
+		atom := rule.Atom.ground(vars)
+		if atom.depth() > maxDepth {
+			err = TooDeep{atom.Name}
+			continue
+		}
+		emit(atom)
+	}
+	if err == nil {
+		// the derived facts are incomplete if it was cancelled
+		err = ctx.Err()
+	}
+	return err
+}
+
+func evalBodyFrom(ctx context.Context, body []Evaluable, sources []*Database, vars Vars, yield func(Vars) bool) {
+	evalEach(ctx, body[0], vars, sources[0], func(vars Vars) bool {
+		switch {
+		case ctx.Err() != nil:
+			return false
+		case len(body) == 1 || vars.err != nil:
+			return yield(vars)
+		default:
+			evalBodyFrom(ctx, body[1:], sources[1:], vars, yield)
+			return ctx.Err() == nil
+		}
+	})
+}
+
+// Fill-in the arguments with the values of the variables.
+// Variables that are left unbound are renamed, so the same
+// facts have always the same representation.
+func (a Atom) ground(vars Vars) Atom {
+	names := make(map[Var]Var)
+	var rename func(term any) any
+	rename = func(term any) any {
+		switch term := term.(type) {
+		case Var:
+			if _, ok := names[term]; !ok {
+				names[term] = Var{Name: fmt.Sprintf("_%d", len(names))}
+			}
+			return names[term]
+		case Compound:
+			var args []any
+			for _, arg := range term.Args {
+				args = append(args, rename(arg))
+			}
+			return Compound{Functor: term.Functor, Args: args}
+		default:
+			return term
+		}
+	}
+	var args []any
+	for _, arg := range a.Args {
+		args = append(args, rename(vars.expand(arg)))
+	}
+	return Atom{
+		Name: a.Name,
+		Args: args,
+	}
+}
@@ -0,0 +1,167 @@
+package datalog
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Built-in predicate, evaluated instead of searching the database.
+type builtin struct {
+	arity int
+	// the ways it can be called, the first one that has its inputs
+	// bound is used, the remaining arguments are bound by it
+	modes []mode
+	// find the substitutions for the arguments that have their variables
+	// expanded, when called in the mode with the given index, and pass
+	// them to yield until it returns false; return false if the arguments
+	// have the wrong types
+	eval func(db *Database, args []any, mode int, vars Vars, yield func(Vars) bool) bool
+}
+
+// Way of calling the built-in predicate.
+type mode struct {
+	// positions of the arguments that need to be bound
+	inputs []int
+	// the inputs need to be the proper lists, but their elements can be unbound,
+	// otherwise they need to be ground
+	lists bool
+}
+
+var builtins = map[Key]builtin{
+	// member(X, L) holds for each element X of the list L
+	"member": {2, []mode{{[]int{1}, true}}, member},
+	// length(L, N) holds if the list L has N elements
+	"length": {2, []mode{{[]int{0}, true}}, length},
+	// append(A, B, C) holds if the list C is A followed by B,
+	// where B can be unbound or a partial list
+	"append": {3, []mode{{[]int{0}, true}, {[]int{2}, true}}, appendLists},
+	// cat(A, B, C) holds if the string C is A followed by B
+	"cat": {3, []mode{{[]int{0, 1}, false}, {[]int{2}, false}}, cat},
+	// strlen(S, N) holds if the string S has N characters
+	"strlen": {2, []mode{{[]int{0}, false}}, strlen},
+	// substr(S, From, Len, R) holds if R is the substring of S
+	// starting at the character From (counted from zero) of length Len
+	"substr": {4, []mode{{[]int{0, 1, 2}, false}}, substr},
+	// lower(S, R) and upper(S, R) hold if R is S in lower or upper case
+	"lower": {2, []mode{{[]int{0}, false}}, lower},
+	"upper": {2, []mode{{[]int{0}, false}}, upper},
+	// split(S, Sep, Part) holds for each Part of S separated by Sep
+	"split": {3, []mode{{[]int{0, 1}, false}}, split},
+	// to_number(S, N) holds if N is the number written as the string S
+	"to_number": {2, []mode{{[]int{0}, false}}, numberOf},
+	// to_string(X, S) holds if S is the constant X written as a string
+	"to_string": {2, []mode{{[]int{0}, false}}, stringOf},
+	// regex_capture(S, Pattern, Group, Out) holds for each match of the regular
+	// expression in S, where Out is the text captured by the Group, given by its
+	// number (zero for the whole match) or name
+	"regex_capture": {4, []mode{{[]int{0, 1, 2}, false}}, regexCapture},
+}
+
+func isBuiltin(key Key) bool {
+	_, ok := builtins[key]
+	return ok
+}
+
+// The literal is an atom searched in the database, not a built-in predicate.
+func isRelation(lit Evaluable) bool {
+	atom, ok := lit.(Atom)
+	return ok && !isBuiltin(atom.Key())
+}
+
+// Evaluate the built-in predicate and pass the matched variable substitutions
+// to yield. It fails with an error if the arguments needed by all of
+// its modes are not bound, or if they have the wrong types.
+func (b builtin) call(query Atom, vars Vars, db *Database, yield func(Vars) bool) {
+	if len(query.Args) != b.arity {
+		yield(vars.fail(fmt.Errorf("%s expects %d arguments: %v", query.Name, b.arity, query)))
+		return
+	}
+	var args []any
+	for _, arg := range query.Args {
+		args = append(args, vars.expand(arg))
+	}
+	mode := slices.IndexFunc(b.modes, func(m mode) bool { return m.ready(args) })
+	if mode < 0 {
+		yield(vars.fail(NotBound{query}))
+		return
+	}
+	if !b.eval(db, args, mode, vars, yield) {
+		yield(vars.fail(InvalidArgs{query}))
+	}
+}
+
+// Check if the built-in predicate can be evaluated with the bound
+// variables, and return the variables it binds.
+func (b builtin) binds(atom Atom, bound map[Var]bool) ([]Var, bool) {
+	if len(atom.Args) != b.arity {
+		return nil, true
+	}
+	for _, m := range b.modes {
+		if allBound(m.needs(atom), bound) {
+			return slices.DeleteFunc(varsOf(atom.Args...), func(v Var) bool { return bound[v] }), true
+		}
+	}
+	return nil, false
+}
+
+// Check if the inputs are bound in the arguments with their variables expanded.
+func (m mode) ready(args []any) bool {
+	for _, i := range m.inputs {
+		if m.lists {
+			// the lists not ending with the empty list are invalid
+			if _, tail := unlist(args[i]); !isGround(tail) {
+				return false
+			}
+		} else if !isGround(args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Variables of the atom that need to be bound to call it in the mode,
+// for the lists these are only the variables standing for their tails.
+func (m mode) needs(atom Atom) []Var {
+	var vars []Var
+	for _, i := range m.inputs {
+		arg := atom.Args[i]
+		if m.lists {
+			_, arg = unlist(arg)
+		}
+		vars = append(vars, varsOf(arg)...)
+	}
+	return vars
+}
+
+// Unify the arguments with the values and pass the result to yield.
+// Return false if yield asked to stop.
+func yieldUnified(args, vals []any, vars Vars, yield func(Vars) bool) bool {
+	if ok, vars := vars.unifyAll(args, vals); ok {
+		return yield(vars)
+	}
+	return true
+}
+
+type NotBound struct {
+	atom Atom
+}
+
+func (err NotBound) Error() string {
+	return fmt.Sprintf("the inputs of the built-in predicate are not bound in %v", err.atom)
+}
+
+type InvalidArgs struct {
+	atom Atom
+}
+
+func (err InvalidArgs) Error() string {
+	return fmt.Sprintf("invalid arguments of the built-in predicate in %v", err.atom)
+}
+
+type BuiltinRedefined struct {
+	key Key
+}
+
+func (err BuiltinRedefined) Error() string {
+	return fmt.Sprintf("%s is a built-in predicate and cannot be redefined", err.key)
+}
@@ -1,17 +1,153 @@
 package datalog
 
 import (
+	"context"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 )
 
-func (c Constraint) Eval(vars Vars, _ Database, ch chan<- Vars) {
-	lhs := vars.expand(c.Lhs)
-	rhs := vars.expand(c.Rhs)
+func (c Constraint) Eval(ctx context.Context, vars Vars, db *Database, ch chan<- Vars) {
+	c.each(ctx, vars, db, sender(ctx, ch))
+}
+
+func (c Constraint) each(_ context.Context, vars Vars, db *Database, yield func(Vars) bool) {
+	lhs, err := vars.Compute(c.Lhs)
+	if err != nil {
+		yield(vars.fail(err))
+		return
+	}
+	rhs, err := vars.Compute(c.Rhs)
+	if err != nil {
+		yield(vars.fail(err))
+		return
+	}
+	if c.Op == "=" && (isVar(lhs) != isVar(rhs) || isCompound(lhs) || isCompound(rhs)) {
+		// bind the unbound variable to the value, or the
+		// variables of the compound terms to their parts
+		if vars.Unify(lhs, rhs) {
+			yield(vars)
+		}
+		return
+	}
+	if c.Op == "matches" {
+		ok, err := db.match(lhs, rhs)
+		if err != nil {
+			yield(vars.fail(err))
+		} else if ok {
+			yield(vars)
+		}
+		return
+	}
 	if c.evalWith(lhs, rhs) {
-		ch <- vars
+		yield(vars)
+	}
+}
+
+// Check if the string matches the regular expression.
+func (db *Database) match(lhs, rhs any) (bool, error) {
+	str, ok := toString(lhs)
+	if !ok {
+		return false, nil
+	}
+	pattern, ok := rhs.(String)
+	if !ok {
+		return false, nil
 	}
+	re, err := db.patterns.compile(string(pattern))
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(str), nil
+}
+
+// Compile the constant patterns of the "matches" operators and the regex_capture
+// built-ins used in the body, so the invalid ones are reported upfront.
+func (db *Database) compilePatterns(body []Evaluable) error {
+	for _, lit := range body {
+		var pattern any
+		switch lit := lit.(type) {
+		case Constraint:
+			if lit.Op == "matches" {
+				pattern = lit.Rhs
+			}
+		case Atom:
+			if lit.Name == "regex_capture" && len(lit.Args) == 4 {
+				pattern = lit.Args[1]
+			}
+		case Aggregate:
+			if err := db.compilePatterns(lit.Body); err != nil {
+				return err
+			}
+		}
+		if pattern, ok := pattern.(String); ok {
+			if err := db.patterns.add(string(pattern)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Cache of the compiled constant patterns used in the rules, so each of them
+// is compiled once. The patterns known only when evaluating, like the ones
+// stored in the facts, are not cached, so the cache does not grow with the data.
+// It is shared by the database and the stores of the facts derived from it.
+type patterns struct {
+	mu       sync.RWMutex
+	compiled map[string]*regexp.Regexp
+}
+
+func newPatterns() *patterns {
+	return &patterns{compiled: make(map[string]*regexp.Regexp)}
+}
+
+// Get the cached pattern, or compile it if it is not a constant one.
+func (p *patterns) compile(pattern string) (*regexp.Regexp, error) {
+	p.mu.RLock()
+	re, ok := p.compiled[pattern]
+	p.mu.RUnlock()
+	if ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, InvalidPattern{pattern, err}
+	}
+	return re, nil
+}
+
+// Compile the constant pattern and add it to the cache.
+func (p *patterns) add(pattern string) error {
+	re, err := p.compile(pattern)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.compiled[pattern] = re
+	p.mu.Unlock()
+	return nil
+}
+
+type InvalidPattern struct {
+	pattern string
+	err     error
+}
+
+func (err InvalidPattern) Error() string {
+	return fmt.Sprintf("invalid regular expression %q: %v", err.pattern, err.err)
+}
+
+func isVar(val any) bool {
+	_, ok := val.(Var)
+	return ok
+}
+
+func isCompound(val any) bool {
+	_, ok := val.(Compound)
+	return ok
 }
 
 // Check if the constraint holds for the arguments.
@@ -24,6 +160,9 @@ func (c Constraint) evalWith(lhs, rhs any) bool {
 		}
 		return false
 	}
+	if isCompound(lhs) || isCompound(rhs) {
+		return c.Op == "!=" && isGround(lhs) && isGround(rhs) && !equal(lhs, rhs)
+	}
 	if lhs, rhs, ok := asType[String](lhs, rhs); ok {
 		if compare(c.Op, lhs, rhs) {
 			return true
@@ -34,6 +173,16 @@ func (c Constraint) evalWith(lhs, rhs any) bool {
 			return true
 		}
 	}
+	if l, r, ok := asFloats(lhs, rhs); ok {
+		if c.Op == "=" || c.Op == "!=" {
+			// the integers and the Floats are different values, like in the unification
+			return (c.Op == "!=") != equal(lhs, rhs)
+		}
+		// but they are ordered by their values
+		if compare(c.Op, l, r) {
+			return true
+		}
+	}
 	return false
 }
 
@@ -68,6 +217,7 @@ func asType[T any](lhs, rhs any) (T, T, bool) {
 }
 
 // If key is a variable and has a value, return the value, otherwise return it.
+// The variables in the compound terms are expanded as well.
 func (vars Vars) expand(key any) any {
 	for {
 		switch k := key.(type) {
@@ -77,6 +227,12 @@ func (vars Vars) expand(key any) any {
 			} else {
 				return key
 			}
+		case Compound:
+			var args []any
+			for _, arg := range k.Args {
+				args = append(args, vars.expand(arg))
+			}
+			return Compound{Functor: k.Functor, Args: args}
 		default:
 			return key
 		}
@@ -89,6 +245,8 @@ func toString(val any) (string, bool) {
 		return string(val), true
 	case int:
 		return strconv.Itoa(val), true
+	case Float:
+		return val.String(), true
 	default:
 		return "", false
 	}
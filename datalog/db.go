@@ -1,83 +1,336 @@
 package datalog
 
 import (
+	"context"
 	"fmt"
-	"sync"
+	"slices"
 )
 
-type (
-	Key      string
-	Database map[Key][]*Node
-)
+type Key string
+
+// Database stores the facts and the rules as trees
+// of Nodes, one set of trees per Key.
+type Database struct {
+	nodes map[Key][]*Node
+	// predicates evaluated using tabling
+	tabled map[predicate]bool
+	// secondary indexes of the predicates
+	indexes map[Key][]*index
+	// rules stored under the key, so they can be found without
+	// traversing the facts
+	rules map[Key][]Rule
+	// number of the facts and rules stored under the key
+	sizes map[Key]int
+	// materialized relations, if any
+	views *views
+	// compiled regular expressions used in the rules
+	patterns *patterns
+	// Strategy used for answering the queries.
+	Strategy Strategy
+	// Order of the query results.
+	Order Order
+	// Semantics of the query results, by default
+	// the duplicated results are skipped.
+	Semantics Semantics
+	// Maximal number of goroutines evaluating the query concurrently,
+	// GOMAXPROCS if zero or less. With a single worker the rules are
+	// evaluated sequentially.
+	Workers int
+	// If set, all the changes are recorded in the journal.
+	Journal Journal
+}
+
+// Journal records the changes made to the database,
+// the Assertion and Retraction values, e.g. to make them durable.
+type Journal interface {
+	Record(change any) error
+}
+
+func NewDatabase() *Database {
+	return &Database{
+		nodes:    make(map[Key][]*Node),
+		tabled:   make(map[predicate]bool),
+		indexes:  make(map[Key][]*index),
+		rules:    make(map[Key][]Rule),
+		sizes:    make(map[Key]int),
+		patterns: newPatterns(),
+	}
+}
 
 // Assert (save) the value to the database.
-func (db Database) Assert(val HasKey) {
+// Rules are checked for safety before saving them.
+// The change is recorded in the journal before it is applied,
+// so it is not applied if recording it fails.
+func (db *Database) Assert(val HasKey) error {
+	if err := db.check(val); err != nil {
+		return err
+	}
+	if err := db.record(Assertion{Fact: val}); err != nil {
+		return err
+	}
+	db.store(val)
+	return db.maintain(val, true)
+}
+
+func (db *Database) assert(val HasKey) error {
+	if err := db.check(val); err != nil {
+		return err
+	}
+	db.store(val)
+	return nil
+}
+
+// Check if the value can be stored in the database.
+func (db *Database) check(val HasKey) error {
+	switch val := val.(type) {
+	case Atom:
+	case Rule:
+		if err := val.checkSafety(); err != nil {
+			return err
+		}
+		if err := db.compilePatterns(val.Body); err != nil {
+			return err
+		}
+	default:
+		panic(fmt.Sprintf("%v has invalid type", val))
+	}
+	if key := val.Key(); isBuiltin(key) {
+		return BuiltinRedefined{key}
+	}
+	return nil
+}
+
+// Store the value that was checked, unless it is already stored.
+func (db *Database) store(val HasKey) {
 	var args []any
 	switch val := val.(type) {
 	case Atom:
 		args = val.Args
 	case Rule:
 		args = val.Args
-	default:
-		panic(fmt.Sprintf("%v has invalid type", val))
 	}
 
 	key := val.Key()
-	nodes := db[key]
+	if db.stored(key, args, val) {
+		return
+	}
+	db.sizes[key]++
+	for _, ix := range db.indexes[key] {
+		ix.add(args, val)
+	}
+	if rule, ok := val.(Rule); ok {
+		db.rules[key] = append(db.rules[key], rule)
+	}
+
+	nodes := db.nodes[key]
 	for _, node := range nodes {
 		if node.add(args, val) {
 			return
 		}
 	}
-	db[key] = append(nodes, nodeFrom(args, val))
+	db.nodes[key] = append(nodes, nodeFrom(args, val))
 }
 
 // Query the database to find all the matches for the query.
 // Return all the matches by sending them to the out channel.
-func (db Database) Query(query Atom, out chan<- Atom) {
+// The query is answered using the Database's Strategy, or
+// the materialized facts, if the relation was materialized, and
+// the results are sent in the Database's Order and Semantics.
+func (db *Database) Query(query Atom, out chan<- Result) error {
+	return db.QueryContext(context.Background(), query, out)
+}
+
+// Query the database like Query, but stop the evaluation when the context
+// is cancelled. In such a case, the out channel is closed after all the
+// goroutines evaluating the query have finished, and the results sent
+// before might be incomplete.
+func (db *Database) QueryContext(ctx context.Context, query Atom, out chan<- Result) error {
+	return db.queryContext(ctx, query, out, db.Strategy)
+}
+
+// Query the database like QueryContext, but answer the query
+// using the strategy instead of the Database's Strategy.
+func (db *Database) QueryStrategy(ctx context.Context, query Atom, strategy Strategy, out chan<- Result) error {
+	return db.queryContext(ctx, query, out, strategy)
+}
+
+func (db *Database) queryContext(ctx context.Context, query Atom, out chan<- Result, strategy Strategy) error {
+	ctx = withPool(ctx, db.Workers)
+	switch {
+	case db.Order == Sorted:
+		ch := make(chan Result)
+		go sortResults(ctx, ch, out, db.Semantics == Set)
+		out = ch
+	case db.Semantics == Set:
+		ch := make(chan Result)
+		go distinctResults(ctx, ch, out)
+		out = ch
+	}
+	if db.isMaterialized(query.Key()) && !proving(ctx) {
+		db.views.store.evalQuery(ctx, query, out)
+		return nil
+	}
+	strata, err := db.stratify(query.Key())
+	if err != nil {
+		close(out)
+		return err
+	}
+	switch strategy {
+	case BottomUp:
+		if err := db.checkStrata(strata); err != nil {
+			close(out)
+			return err
+		}
+		if prog, goal, ok := db.magicSets(query); ok {
+			return db.evalMagic(ctx, prog, goal, query, out)
+		}
+		store, err := db.fixpoint(ctx, strata)
+		if err != nil {
+			close(out)
+			return err
+		}
+		store.evalQuery(ctx, query, out)
+	default:
+		db.evalQuery(db.withTables(ctx, strata), query, out)
+	}
+	return nil
+}
+
+// Evaluate the query top-down and send the results to the out channel.
+// The evaluation stops at the first error.
+func (db *Database) evalQuery(ctx context.Context, query Atom, out chan<- Result) {
+	// cancelled on errors, so the remaining work is skipped
+	evalCtx, cancel := context.WithCancel(ctx)
+
 	ch := make(chan Vars)
 	go func() {
 		defer close(ch)
-		query.Eval(Vars{}, db, ch)
+		query.Eval(evalCtx, Vars{}, db, ch)
 	}()
 
 	// post-process
 	go func() {
 		defer close(out)
+		defer cancel()
+		failed := false
 		for vars := range ch {
+			if failed {
+				// consume the results, so the goroutines can finish
+				continue
+			}
+			if vars.err != nil {
+				send(ctx, out, Result{Err: vars.err})
+				failed = true
+				cancel()
+				continue
+			}
 			vars.substitute()
-			atom := query.Materialize(vars)
-			out <- atom
+			result := Result{Atom: query.Materialize(vars)}
+			if vars.trace != nil {
+				result.Proof = vars.trace.proof
+			}
+			send(ctx, out, result)
 		}
 	}()
 }
 
-// Find the potential (un-unified) matches to the query,
-// send them to the out channel.
-func (db Database) find(query Atom, out chan<- Evaluable) {
-	defer close(out)
-	key := query.Key()
-	if nodes, ok := db[key]; ok {
-		var wg sync.WaitGroup
-		for _, node := range nodes {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				node.find(query.Args, out)
-			}()
-		}
-		wg.Wait()
+// Find the potential (un-unified) matches to the query, with the variables
+// bound by vars substituted, call yield for each of them. If the query has
+// constants at all the positions of an index, the index is used.
+func (db *Database) find(ctx context.Context, query Atom, vars Vars, yield func(Evaluable)) {
+	lookup := Atom{Name: query.Name}
+	for _, arg := range query.Args {
+		lookup.Args = append(lookup.Args, vars.expand(arg))
+	}
+	if ix := db.indexFor(lookup); ix != nil {
+		ix.find(ctx, lookup.Args, yield)
+		return
+	}
+	for _, node := range db.nodes[query.Key()] {
+		node.find(ctx, lookup.Args, yield)
 	}
 }
 
-// Remove the value from the database if it exists.
-func (db Database) Remove(val Atom) {
+// Remove the value from the database if it exists. Like with
+// Assert, the change is recorded before it is applied.
+func (db *Database) Remove(val Atom) error {
+	if err := db.record(Retraction{Fact: val}); err != nil {
+		return err
+	}
 	key := val.Key()
-	nodes := db[key]
+	if db.contains(val) {
+		db.sizes[key]--
+	}
+	nodes := db.nodes[key]
 	for _, node := range nodes {
 		node.remove(val.Args, val)
 	}
-	db[key] = nodes
+	db.nodes[key] = nodes
+	for _, ix := range db.indexes[key] {
+		ix.remove(val)
+	}
+	return db.maintain(val, false)
+}
+
+// Record the change in the journal, if there is one.
+func (db *Database) record(change any) error {
+	if db.Journal == nil {
+		return nil
+	}
+	return db.Journal.Record(change)
+}
+
+// Check if exactly the same value is stored in the database.
+func (db *Database) contains(val Atom) bool {
+	return db.stored(val.Key(), val.Args, val)
+}
+
+// Check if exactly the same Atom or Rule is stored under the key and arguments path.
+func (db *Database) stored(key Key, args []any, val any) bool {
+	for _, node := range db.nodes[key] {
+		if node.contains(args, val) {
+			return true
+		}
+	}
+	return false
+}
+
+// Assert the value if it was not present in the database,
+// report if it was added.
+func (db *Database) insert(val Atom) bool {
+	if db.contains(val) {
+		return false
+	}
+	db.assert(val)
+	return true
+}
+
+// All the Atoms and Rules stored under the key.
+func (db *Database) clauses(key Key) []any {
+	var vals []any
+	for _, node := range db.nodes[key] {
+		vals = append(vals, node.values()...)
+	}
+	return vals
+}
+
+// Arities of the facts and rules stored under the key, in increasing order.
+func (db *Database) Arities(key Key) []int {
+	var arities []int
+	for _, val := range db.clauses(key) {
+		var n int
+		switch val := val.(type) {
+		case Atom:
+			n = len(val.Args)
+		case Rule:
+			n = len(val.Args)
+		}
+		if !slices.Contains(arities, n) {
+			arities = append(arities, n)
+		}
+	}
+	slices.Sort(arities)
+	return arities
 }
 
 // The value can be stored in a Database.
@@ -98,12 +351,7 @@ func (r Rule) Key() Key {
 func (a Atom) Materialize(vars Vars) Atom {
 	var args []any
 	for _, arg := range a.Args {
-		if v, ok := arg.(Var); ok {
-			if val, ok := vars.Get(v); ok {
-				arg = val
-			}
-		}
-		args = append(args, arg)
+		args = append(args, vars.expand(arg))
 	}
 	return Atom{
 		Name: a.Name,
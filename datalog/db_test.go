@@ -1,13 +1,15 @@
 package datalog
 
 import (
+	"fmt"
+	"runtime"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 )
 
 func TestDbAssert(t *testing.T) {
-	db := make(Database)
+	db := NewDatabase()
 
 	// add a value
 	first := Atom{
@@ -16,7 +18,7 @@ func TestDbAssert(t *testing.T) {
 	}
 	db.Assert(first)
 
-	expected1 := Database{
+	expected1 := map[Key][]*Node{
 		"foo": []*Node{
 			{
 				Value: 1,
@@ -34,8 +36,8 @@ func TestDbAssert(t *testing.T) {
 		},
 	}
 
-	if !cmp.Equal(db, expected1) {
-		t.Errorf("expected: %v, got: %v", expected1, db)
+	if !cmp.Equal(db.nodes, expected1) {
+		t.Errorf("expected: %v, got: %v", expected1, db.nodes)
 	}
 
 	// no-op, this value already exists
@@ -45,8 +47,8 @@ func TestDbAssert(t *testing.T) {
 	}
 	db.Assert(second)
 
-	if !cmp.Equal(db, expected1) {
-		t.Errorf("expected: %v, got: %v", expected1, db)
+	if !cmp.Equal(db.nodes, expected1) {
+		t.Errorf("expected: %v, got: %v", expected1, db.nodes)
 	}
 
 	// add a new one
@@ -56,7 +58,7 @@ func TestDbAssert(t *testing.T) {
 	}
 	db.Assert(third)
 
-	expected3 := Database{
+	expected3 := map[Key][]*Node{
 		"foo": []*Node{
 			{
 				Value: 1,
@@ -82,8 +84,8 @@ func TestDbAssert(t *testing.T) {
 		},
 	}
 
-	if !cmp.Equal(db, expected3) {
-		t.Errorf("expected: %v, got: %v", expected3, db)
+	if !cmp.Equal(db.nodes, expected3) {
+		t.Errorf("expected: %v, got: %v", expected3, db.nodes)
 	}
 
 	// add one on a new branch
@@ -93,7 +95,7 @@ func TestDbAssert(t *testing.T) {
 	}
 	db.Assert(fourth)
 
-	expected4 := Database{
+	expected4 := map[Key][]*Node{
 		"foo": []*Node{
 			{
 				Value: 1,
@@ -132,7 +134,133 @@ func TestDbAssert(t *testing.T) {
 		},
 	}
 
-	if !cmp.Equal(db, expected4) {
-		t.Errorf("expected: %v, got: %v", expected4, db)
+	if !cmp.Equal(db.nodes, expected4) {
+		t.Errorf("expected: %v, got: %v", expected4, db.nodes)
 	}
 }
+
+// Facts foo(0), ..., foo(n-1) and the chain edge(0, 1), ..., edge(n-1, n)
+// with the rules for the paths along it.
+func benchmarkDatabase(n int) *Database {
+	db := NewDatabase()
+	for i := 0; i < n; i++ {
+		db.Assert(Atom{Name: "foo", Args: []any{i}})
+		db.Assert(Atom{Name: "edge", Args: []any{i, i + 1}})
+	}
+	X, Y, Z := Var{Name: "X"}, Var{Name: "Y"}, Var{Name: "Z"}
+	db.Assert(Rule{
+		Atom: Atom{Name: "path", Args: []any{X, Y}},
+		Body: []Evaluable{Atom{Name: "edge", Args: []any{X, Y}}},
+	})
+	db.Assert(Rule{
+		Atom: Atom{Name: "path", Args: []any{X, Y}},
+		Body: []Evaluable{
+			Atom{Name: "edge", Args: []any{X, Z}},
+			Atom{Name: "path", Args: []any{Z, Y}},
+		},
+	})
+	return db
+}
+
+func benchmarkQuery(b *testing.B, db *Database, query Atom) {
+	for _, workers := range []int{1, 4, 0} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			db.Workers = workers
+			for i := 0; i < b.N; i++ {
+				out := make(chan Result)
+				if err := db.Query(query, out); err != nil {
+					b.Fatal(err)
+				}
+				for result := range out {
+					if result.Err != nil {
+						b.Fatal(result.Err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSequentialQuery(t *testing.T) {
+	db := benchmarkDatabase(20)
+	X := Var{Name: "X"}
+	db.Assert(Rule{
+		Atom: Atom{Name: "next", Args: []any{X}},
+		Body: []Evaluable{
+			Atom{Name: "path", Args: []any{0, X}},
+			Negation{Atom{Name: "edge", Args: []any{X, 0}}},
+		},
+	})
+	db.Workers = 1
+	// no goroutine removing the duplicates
+	db.Semantics = Bag
+
+	before := runtime.NumGoroutine()
+	out := make(chan Result)
+	if err := db.Query(Atom{Name: "next", Args: []any{X}}, out); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for result := range out {
+		// the evaluation of the next result is in progress,
+		// but only the goroutines of the query itself are running
+		if n := runtime.NumGoroutine() - before; n > 2 {
+			t.Errorf("expected at most 2 goroutines, got %d", n)
+		}
+		if result.Err != nil {
+			t.Fatal(result.Err)
+		}
+		n++
+	}
+	if n != 20 {
+		t.Errorf("expected 20 results, got %d", n)
+	}
+}
+
+type failingJournal struct{}
+
+func (failingJournal) Record(any) error {
+	return fmt.Errorf("disk is full")
+}
+
+func TestJournalFailure(t *testing.T) {
+	db := NewDatabase()
+	fact := Atom{Name: "foo", Args: []any{String("a")}}
+	db.Assert(fact)
+
+	db.Journal = failingJournal{}
+	if err := db.Assert(Atom{Name: "foo", Args: []any{String("b")}}); err == nil {
+		t.Error("expected an error")
+	}
+	if err := db.Remove(fact); err == nil {
+		t.Error("expected an error")
+	}
+	// the changes that were not recorded are not applied
+	db.Journal = nil
+	result := queryAll(t, db, Atom{Name: "foo", Args: []any{Var{Name: "X"}}})
+	if expected := []string{"foo(a)"}; !cmp.Equal(result, expected) {
+		t.Errorf("expected: %v, got: %v", expected, result)
+	}
+}
+
+func BenchmarkQueryFacts(b *testing.B) {
+	db := benchmarkDatabase(10000)
+	benchmarkQuery(b, db, Atom{Name: "foo", Args: []any{Var{Name: "X"}}})
+}
+
+func BenchmarkQueryRules(b *testing.B) {
+	db := benchmarkDatabase(200)
+	benchmarkQuery(b, db, Atom{Name: "path", Args: []any{0, Var{Name: "Y"}}})
+}
+
+func BenchmarkQueryIndex(b *testing.B) {
+	db := benchmarkDatabase(10000)
+	query := Atom{Name: "edge", Args: []any{Var{Name: "X"}, 5000}}
+	b.Run("tree", func(b *testing.B) {
+		benchmarkQuery(b, db, query)
+	})
+	db.Index("edge", 2, []int{1})
+	b.Run("index", func(b *testing.B) {
+		benchmarkQuery(b, db, query)
+	})
+}
@@ -0,0 +1,427 @@
+package datalog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// Version of the format used by WriteTo and ReadFrom.
+//
+// The database is saved as JSON Lines, where the first line is
+// the header with the version of the format, and each following
+// line is a single fact or rule:
+//
+//	{"format":"datalogo","version":1}
+//	{"atom":{"name":"foo","args":[{"str":"a"},{"int":1}]}}
+//	{"rule":{"head":{"name":"bar","args":[{"var":"X"}]},"body":[{"atom":{"name":"foo","args":[{"var":"X"},{"wildcard":true}]}}]}}
+const FormatVersion = 1
+
+type header struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+type jsonClause struct {
+	Atom *jsonAtom `json:"atom,omitempty"`
+	Rule *jsonRule `json:"rule,omitempty"`
+}
+
+type jsonAtom struct {
+	Name string     `json:"name"`
+	Args []jsonTerm `json:"args"`
+}
+
+type jsonRule struct {
+	Head jsonAtom      `json:"head"`
+	Body []jsonLiteral `json:"body"`
+}
+
+type jsonLiteral struct {
+	Atom       *jsonAtom       `json:"atom,omitempty"`
+	Negation   *jsonAtom       `json:"negation,omitempty"`
+	Constraint *jsonConstraint `json:"constraint,omitempty"`
+	Aggregate  *jsonAggregate  `json:"aggregate,omitempty"`
+}
+
+type jsonConstraint struct {
+	Op  string   `json:"op"`
+	Lhs jsonTerm `json:"lhs"`
+	Rhs jsonTerm `json:"rhs"`
+}
+
+type jsonAggregate struct {
+	Func   string        `json:"func"`
+	Result jsonTerm      `json:"result"`
+	Term   *jsonTerm     `json:"term,omitempty"`
+	Body   []jsonLiteral `json:"body"`
+}
+
+type jsonTerm struct {
+	Int      *int      `json:"int,omitempty"`
+	Float    *float64  `json:"float,omitempty"`
+	Str      *string   `json:"str,omitempty"`
+	Var      *string   `json:"var,omitempty"`
+	Counter  uint      `json:"counter,omitempty"`
+	Wildcard bool      `json:"wildcard,omitempty"`
+	Expr     *jsonExpr `json:"expr,omitempty"`
+	Compound *jsonAtom `json:"compound,omitempty"`
+}
+
+type jsonExpr struct {
+	Op  string    `json:"op"`
+	Lhs *jsonTerm `json:"lhs,omitempty"`
+	Rhs jsonTerm  `json:"rhs"`
+}
+
+// Write all the facts and rules stored in the database, implements io.WriterTo.
+func (db *Database) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	enc := json.NewEncoder(cw)
+	if err := enc.Encode(header{"datalogo", FormatVersion}); err != nil {
+		return cw.n, err
+	}
+
+	// sorted for a stable output
+	var keys []Key
+	for key := range db.nodes {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		for _, val := range db.clauses(key) {
+			clause, err := encodeClause(val)
+			if err != nil {
+				return cw.n, err
+			}
+			if err := enc.Encode(clause); err != nil {
+				return cw.n, err
+			}
+		}
+	}
+	return cw.n, nil
+}
+
+// Read the facts and rules saved with WriteTo and assert them,
+// implements io.ReaderFrom.
+func (db *Database) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countingReader{r: r}
+	scanner := bufio.NewScanner(cr)
+	scanner.Buffer(nil, 1<<30)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return cr.n, err
+		}
+		return cr.n, fmt.Errorf("missing header")
+	}
+	var h header
+	if err := json.Unmarshal(scanner.Bytes(), &h); err != nil {
+		return cr.n, err
+	}
+	if h.Format != "datalogo" {
+		return cr.n, fmt.Errorf("invalid format: %q", h.Format)
+	}
+	if h.Version != FormatVersion {
+		return cr.n, fmt.Errorf("unsupported format version: %d", h.Version)
+	}
+
+	for line := 2; scanner.Scan(); line++ {
+		var clause jsonClause
+		if err := json.Unmarshal(scanner.Bytes(), &clause); err != nil {
+			return cr.n, fmt.Errorf("line %d: %w", line, err)
+		}
+		val, err := decodeClause(clause)
+		if err != nil {
+			return cr.n, fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := db.Assert(val); err != nil {
+			return cr.n, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return cr.n, scanner.Err()
+}
+
+// Encode the fact or rule as JSON, in the same format as used by WriteTo.
+func MarshalClause(val HasKey) ([]byte, error) {
+	clause, err := encodeClause(val)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(clause)
+}
+
+// Decode the fact or rule encoded with MarshalClause.
+func UnmarshalClause(data []byte) (HasKey, error) {
+	var clause jsonClause
+	if err := json.Unmarshal(data, &clause); err != nil {
+		return nil, err
+	}
+	return decodeClause(clause)
+}
+
+func encodeClause(val any) (jsonClause, error) {
+	switch val := val.(type) {
+	case Atom:
+		atom, err := encodeAtom(val)
+		return jsonClause{Atom: &atom}, err
+	case Rule:
+		head, err := encodeAtom(val.Atom)
+		if err != nil {
+			return jsonClause{}, err
+		}
+		body, err := encodeBody(val.Body)
+		return jsonClause{Rule: &jsonRule{head, body}}, err
+	default:
+		return jsonClause{}, fmt.Errorf("%v cannot be encoded", val)
+	}
+}
+
+func decodeClause(clause jsonClause) (HasKey, error) {
+	switch {
+	case clause.Atom != nil:
+		return decodeAtom(*clause.Atom)
+	case clause.Rule != nil:
+		head, err := decodeAtom(clause.Rule.Head)
+		if err != nil {
+			return nil, err
+		}
+		body, err := decodeBody(clause.Rule.Body)
+		return Rule{Atom: head, Body: body}, err
+	default:
+		return nil, fmt.Errorf("empty clause")
+	}
+}
+
+func encodeAtom(atom Atom) (jsonAtom, error) {
+	args := make([]jsonTerm, 0, len(atom.Args))
+	for _, arg := range atom.Args {
+		term, err := encodeTerm(arg)
+		if err != nil {
+			return jsonAtom{}, err
+		}
+		args = append(args, term)
+	}
+	return jsonAtom{atom.Name, args}, nil
+}
+
+func decodeAtom(atom jsonAtom) (Atom, error) {
+	var args []any
+	for _, arg := range atom.Args {
+		term, err := decodeTerm(arg)
+		if err != nil {
+			return Atom{}, err
+		}
+		args = append(args, term)
+	}
+	return Atom{Name: atom.Name, Args: args}, nil
+}
+
+func encodeBody(body []Evaluable) ([]jsonLiteral, error) {
+	var out []jsonLiteral
+	for _, lit := range body {
+		var (
+			enc jsonLiteral
+			err error
+		)
+		switch lit := lit.(type) {
+		case Atom:
+			var atom jsonAtom
+			atom, err = encodeAtom(lit)
+			enc.Atom = &atom
+		case Negation:
+			var atom jsonAtom
+			atom, err = encodeAtom(lit.Atom)
+			enc.Negation = &atom
+		case Constraint:
+			var c jsonConstraint
+			c, err = encodeConstraint(lit)
+			enc.Constraint = &c
+		case Aggregate:
+			var a jsonAggregate
+			a, err = encodeAggregate(lit)
+			enc.Aggregate = &a
+		default:
+			err = fmt.Errorf("%v cannot be encoded", lit)
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, enc)
+	}
+	return out, nil
+}
+
+func decodeBody(body []jsonLiteral) ([]Evaluable, error) {
+	var out []Evaluable
+	for _, lit := range body {
+		var (
+			dec Evaluable
+			err error
+		)
+		switch {
+		case lit.Atom != nil:
+			dec, err = decodeAtom(*lit.Atom)
+		case lit.Negation != nil:
+			var atom Atom
+			atom, err = decodeAtom(*lit.Negation)
+			dec = Negation{Atom: atom}
+		case lit.Constraint != nil:
+			dec, err = decodeConstraint(*lit.Constraint)
+		case lit.Aggregate != nil:
+			dec, err = decodeAggregate(*lit.Aggregate)
+		default:
+			err = fmt.Errorf("empty literal")
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, dec)
+	}
+	return out, nil
+}
+
+func encodeConstraint(c Constraint) (jsonConstraint, error) {
+	lhs, err := encodeTerm(c.Lhs)
+	if err != nil {
+		return jsonConstraint{}, err
+	}
+	rhs, err := encodeTerm(c.Rhs)
+	return jsonConstraint{c.Op, lhs, rhs}, err
+}
+
+func decodeConstraint(c jsonConstraint) (Constraint, error) {
+	lhs, err := decodeTerm(c.Lhs)
+	if err != nil {
+		return Constraint{}, err
+	}
+	rhs, err := decodeTerm(c.Rhs)
+	return Constraint{Op: c.Op, Lhs: lhs, Rhs: rhs}, err
+}
+
+func encodeAggregate(a Aggregate) (jsonAggregate, error) {
+	result, err := encodeTerm(a.Result)
+	if err != nil {
+		return jsonAggregate{}, err
+	}
+	var term *jsonTerm
+	if a.Term != nil {
+		t, err := encodeTerm(a.Term)
+		if err != nil {
+			return jsonAggregate{}, err
+		}
+		term = &t
+	}
+	body, err := encodeBody(a.Body)
+	return jsonAggregate{a.Func, result, term, body}, err
+}
+
+func decodeAggregate(a jsonAggregate) (Aggregate, error) {
+	result, err := decodeTerm(a.Result)
+	if err != nil {
+		return Aggregate{}, err
+	}
+	var term any
+	if a.Term != nil {
+		term, err = decodeTerm(*a.Term)
+		if err != nil {
+			return Aggregate{}, err
+		}
+	}
+	body, err := decodeBody(a.Body)
+	return Aggregate{
+		Func:   a.Func,
+		Result: result,
+		Term:   term,
+		Body:   body,
+	}, err
+}
+
+func encodeTerm(term any) (jsonTerm, error) {
+	switch term := term.(type) {
+	case int:
+		return jsonTerm{Int: &term}, nil
+	case Float:
+		float := float64(term)
+		return jsonTerm{Float: &float}, nil
+	case String:
+		str := string(term)
+		return jsonTerm{Str: &str}, nil
+	case Var:
+		return jsonTerm{Var: &term.Name, Counter: term.Counter}, nil
+	case Wildcard:
+		return jsonTerm{Wildcard: true}, nil
+	case Expr:
+		var lhs *jsonTerm
+		if term.Lhs != nil {
+			t, err := encodeTerm(term.Lhs)
+			if err != nil {
+				return jsonTerm{}, err
+			}
+			lhs = &t
+		}
+		rhs, err := encodeTerm(term.Rhs)
+		return jsonTerm{Expr: &jsonExpr{term.Op, lhs, rhs}}, err
+	case Compound:
+		compound, err := encodeAtom(Atom{Name: term.Functor, Args: term.Args})
+		return jsonTerm{Compound: &compound}, err
+	default:
+		return jsonTerm{}, fmt.Errorf("%v of type %T cannot be encoded", term, term)
+	}
+}
+
+func decodeTerm(term jsonTerm) (any, error) {
+	switch {
+	case term.Int != nil:
+		return *term.Int, nil
+	case term.Float != nil:
+		return Float(*term.Float), nil
+	case term.Str != nil:
+		return String(*term.Str), nil
+	case term.Var != nil:
+		return Var{Name: *term.Var, Counter: term.Counter}, nil
+	case term.Wildcard:
+		return Wildcard{}, nil
+	case term.Expr != nil:
+		var lhs any
+		if term.Expr.Lhs != nil {
+			val, err := decodeTerm(*term.Expr.Lhs)
+			if err != nil {
+				return nil, err
+			}
+			lhs = val
+		}
+		rhs, err := decodeTerm(term.Expr.Rhs)
+		return Expr{Op: term.Expr.Op, Lhs: lhs, Rhs: rhs}, err
+	case term.Compound != nil:
+		atom, err := decodeAtom(*term.Compound)
+		return Compound{Functor: atom.Name, Args: atom.Args}, err
+	default:
+		return nil, fmt.Errorf("empty term")
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,103 @@
+package datalog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteReadRoundTrip(t *testing.T) {
+	clauses := []HasKey{
+		Atom{
+			Name: "foo",
+			Args: []any{String("a"), String("Hello, world!"), 0, -42, Float(-0.25), Float(3), Var{Name: "X"}, Wildcard{}},
+		},
+		Atom{
+			Name: "foo",
+			Args: []any{String(""), Var{Name: "X", Counter: 3}},
+		},
+		Atom{
+			Name: "at",
+			Args: []any{Compound{
+				Functor: "point",
+				Args:    []any{1, Compound{Functor: "z", Args: []any{Var{Name: "Z"}}}},
+			}},
+		},
+		Atom{
+			Name: "tags",
+			Args: []any{NewList([]any{String("a"), Nil}, Var{Name: "T"}), Nil},
+		},
+		Rule{
+			Atom: Atom{
+				Name: "bar",
+				Args: []any{Var{Name: "X"}, Var{Name: "N"}},
+			},
+			Body: []Evaluable{
+				Atom{
+					Name: "foo",
+					Args: []any{Var{Name: "X"}, Wildcard{}},
+				},
+				Aggregate{
+					Func:   "sum",
+					Result: Var{Name: "N"},
+					Term:   Var{Name: "W"},
+					Body: []Evaluable{
+						Atom{
+							Name: "baz",
+							Args: []any{Var{Name: "X"}, Var{Name: "W"}},
+						},
+					},
+				},
+				Constraint{
+					Op:  "<",
+					Lhs: Expr{Op: "-", Rhs: Var{Name: "N"}},
+					Rhs: Expr{Op: "mod", Lhs: Var{Name: "X"}, Rhs: 2},
+				},
+				Negation{
+					Atom: Atom{
+						Name: "baz",
+						Args: []any{Var{Name: "X"}, 1},
+					},
+				},
+			},
+		},
+	}
+
+	db := NewDatabase()
+	for _, clause := range clauses {
+		if err := db.Assert(clause); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	written, err := db.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if written != int64(buf.Len()) {
+		t.Errorf("expected %d bytes to be written, got %d", buf.Len(), written)
+	}
+
+	result := NewDatabase()
+	read, err := result.ReadFrom(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if read != written {
+		t.Errorf("expected %d bytes to be read, got %d", written, read)
+	}
+	if !cmp.Equal(db.nodes, result.nodes) {
+		t.Errorf("expected: %v, got: %v", db.nodes, result.nodes)
+	}
+}
+
+func TestReadFromInvalidVersion(t *testing.T) {
+	input := `{"format":"datalogo","version":999}`
+	_, err := NewDatabase().ReadFrom(strings.NewReader(input))
+	if err == nil || err.Error() != "unsupported format version: 999" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
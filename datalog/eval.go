@@ -1,70 +1,213 @@
 package datalog
 
-import "sync"
+import (
+	"context"
+	"sync"
+)
 
 // Find all the facts in the database that unify with the query
 // and send the matched variable substitutions to the out channel.
-func (query Atom) Eval(vars Vars, db Database, out chan<- Vars) {
-	var wg sync.WaitGroup
-	ch := make(chan Evaluable)
-	go db.find(query, ch)
+// The built-in predicates, like member, are evaluated instead.
+func (query Atom) Eval(ctx context.Context, vars Vars, db *Database, out chan<- Vars) {
+	query.each(ctx, vars, db, sender(ctx, out))
+}
+
+// Like Eval, but pass the matched variable substitutions to yield.
+// It can be called concurrently by the workers evaluating the rules.
+func (query Atom) each(ctx context.Context, vars Vars, db *Database, yield func(Vars) bool) {
+	if b, ok := builtins[query.Key()]; ok {
+		b.call(query, vars, db, yield)
+		return
+	}
+	if db.isTabled(query) {
+		if ts := tablesFrom(ctx); ts != nil {
+			ts.eval(ctx, query, vars, db, yield)
+			return
+		}
+	}
+	query.resolve(ctx, vars, db, yield)
+}
 
+// Unify the query with all the matching facts and rules.
+// The facts are unified first, in the current goroutine, so their
+// results are not delayed by the (possibly non-terminating) recursion.
+// Then the rules are evaluated by the idle workers of the pool,
+// or in the current goroutine if there are none.
+func (query Atom) resolve(ctx context.Context, vars Vars, db *Database, yield func(Vars) bool) {
 	vars.Counter++
-	for fact := range ch {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			query.unify(fact, vars, db, out)
-		}()
+	var rules []Rule
+	db.find(ctx, query, vars, func(fact Evaluable) {
+		if rule, ok := fact.(Rule); ok {
+			rules = append(rules, rule)
+		} else {
+			query.unify(ctx, fact, vars, db, yield)
+		}
+	})
+
+	var wg sync.WaitGroup
+	p := poolFrom(ctx)
+	for _, rule := range rules {
+		if ctx.Err() != nil {
+			break
+		}
+		p.run(&wg, func() {
+			query.unify(ctx, rule, vars, db, yield)
+		})
 	}
 	wg.Wait()
 }
 
+// Send the value to the out channel, unless the evaluation was cancelled.
+// Return false if it was cancelled.
+func send[T any](ctx context.Context, out chan<- T, val T) bool {
+	select {
+	case out <- val:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// The yield function sending the values to the out channel.
+func sender[T any](ctx context.Context, out chan<- T) func(T) bool {
+	return func(val T) bool {
+		return send(ctx, out, val)
+	}
+}
+
 // Unify the query with the fact. If the query is matched with
-// Rules, evaluate them recursively. Send send the matched
-// variable substitutions to the out channel.
-func (query Atom) unify(fact any, vars Vars, db Database, out chan<- Vars) {
+// Rules, evaluate them recursively. Pass the matched variable
+// substitutions to yield.
+func (query Atom) unify(ctx context.Context, fact any, vars Vars, db *Database, yield func(Vars) bool) {
 	switch fact := fact.(type) {
 	case Atom:
-		atom := fact.renameVars(vars)
-		if ok, vars := vars.unifyAll(query.Args, atom.Args); ok {
-			out <- vars
+		var proof *Proof
+		if proving(ctx) {
+			proof = &Proof{Literal: fact}
 		}
+		query.unifyFact(fact, proof, vars, yield)
 	case Rule:
 		rule := fact.renameVars(vars)
 		if ok, vars := vars.unifyAll(query.Args, rule.Args); ok {
-			evalBody(rule.Body, vars, db, out)
+			order := db.planOrder(rule.Body, vars.bound(rule.Body))
+			body := permute(rule.Body, order)
+			eval := func(yield func(Vars) bool) {
+				if proving(ctx) {
+					fact.prove(ctx, body, order, vars, db, yield)
+				} else {
+					evalBody(ctx, body, vars, db, yield)
+				}
+			}
+			if hasCompound(rule.Args) {
+				checkDepth(rule.Atom, yield, eval)
+			} else {
+				eval(yield)
+			}
 		}
 	}
 }
 
-// Evaluate the body of the Rule, send the matched variable substitutions
-// to the out channel.
-func evalBody(body []Evaluable, vars Vars, db Database, out chan<- Vars) {
-	if len(body) == 0 {
-		// better than index error
-		panic("rule's body cannot be empty")
+// Unify the query with the fact, and add its proof to the trace, if given.
+func (query Atom) unifyFact(fact Atom, proof *Proof, vars Vars, yield func(Vars) bool) {
+	atom := fact.renameVars(vars)
+	if ok, vars := vars.unifyAll(query.Args, atom.Args); ok {
+		if proof != nil {
+			vars.trace = vars.trace.push(proof)
+		}
+		yield(vars)
 	}
+}
+
+// The literals passing their results to the yield function,
+// so no goroutine is needed to consume them.
+type yielder interface {
+	each(ctx context.Context, vars Vars, db *Database, yield func(Vars) bool)
+}
 
+// Evaluate the literal and pass the matched variable substitutions to yield.
+// The literals not implementing yielder are evaluated in a new goroutine.
+func evalEach(ctx context.Context, lit Evaluable, vars Vars, db *Database, yield func(Vars) bool) {
+	if lit, ok := lit.(yielder); ok {
+		lit.each(ctx, vars, db, yield)
+		return
+	}
 	ch := make(chan Vars)
 	go func() {
-		body[0].Eval(vars, db, ch)
-		close(ch)
+		defer close(ch)
+		lit.Eval(ctx, vars, db, ch)
 	}()
-
 	for vars := range ch {
-		if len(body) == 1 {
-			out <- vars
-		} else {
-			evalBody(body[1:], vars, db, out)
+		// on cancellation, the remaining results are consumed,
+		// so the goroutine can finish
+		yield(vars)
+	}
+}
+
+// Evaluate the body of the Rule, pass the matched variable substitutions
+// to yield. Each literal is evaluated for the substitutions matched by
+// the previous one, as soon as they are found.
+func evalBody(ctx context.Context, body []Evaluable, vars Vars, db *Database, yield func(Vars) bool) {
+	if len(body) == 0 {
+		// better than index error
+		panic("rule's body cannot be empty")
+	}
+
+	// the atoms searched in the database add their proofs themselves
+	prove := !isRelation(body[0]) && proving(ctx)
+
+	evalEach(ctx, body[0], vars, db, func(vars Vars) bool {
+		if prove && vars.err == nil {
+			vars.trace = vars.trace.push(&Proof{
+				Literal: renameBody(body[:1], Vars{})[0],
+			})
+		}
+		switch {
+		case ctx.Err() != nil:
+			return false
+		case len(body) == 1 || vars.err != nil:
+			return yield(vars)
+		default:
+			evalBody(ctx, body[1:], vars, db, yield)
+			return ctx.Err() == nil
 		}
+	})
+}
+
+// Negation as failure: pass the substitutions further
+// only if the query has no matches.
+func (n Negation) Eval(ctx context.Context, vars Vars, db *Database, out chan<- Vars) {
+	n.each(ctx, vars, db, sender(ctx, out))
+}
+
+func (n Negation) each(ctx context.Context, vars Vars, db *Database, yield func(Vars) bool) {
+	var (
+		mu    sync.Mutex
+		found bool
+		err   error
+	)
+	n.Atom.each(ctx, vars, db, func(vars Vars) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		found = true
+		if err == nil {
+			err = vars.err
+		}
+		return ctx.Err() == nil
+	})
+	switch {
+	case ctx.Err() != nil:
+		// the search was not finished
+	case err != nil:
+		yield(vars.fail(err))
+	case !found:
+		yield(vars)
 	}
 }
 
 func (a Atom) renameVars(vars Vars) Atom {
 	var args []any
 	for _, arg := range a.Args {
-		arg = vars.rename(arg)
+		arg = renameTerm(arg, vars)
 		args = append(args, arg)
 	}
 	return Atom{
@@ -74,9 +217,15 @@ func (a Atom) renameVars(vars Vars) Atom {
 }
 
 func (r Rule) renameVars(vars Vars) Rule {
-	atom := r.Atom.renameVars(vars)
-	var body []Evaluable
-	for _, lit := range r.Body {
+	return Rule{
+		Atom: r.Atom.renameVars(vars),
+		Body: renameBody(r.Body, vars),
+	}
+}
+
+func renameBody(body []Evaluable, vars Vars) []Evaluable {
+	var out []Evaluable
+	for _, lit := range body {
 		switch this := lit.(type) {
 		case Atom:
 			lit = this.renameVars(vars)
@@ -84,19 +233,20 @@ func (r Rule) renameVars(vars Vars) Rule {
 			lit = this.renameVars(vars)
 		case Constraint:
 			lit = this.renameVars(vars)
+		case Negation:
+			lit = Negation{Atom: this.Atom.renameVars(vars)}
+		case Aggregate:
+			lit = this.renameVars(vars)
 		}
-		body = append(body, lit)
-	}
-	return Rule{
-		Atom: atom,
-		Body: body,
+		out = append(out, lit)
 	}
+	return out
 }
 
 func (c Constraint) renameVars(vars Vars) Constraint {
 	return Constraint{
 		Op:  c.Op,
-		Lhs: vars.rename(c.Lhs),
-		Rhs: vars.rename(c.Rhs),
+		Lhs: renameTerm(c.Lhs, vars),
+		Rhs: renameTerm(c.Rhs, vars),
 	}
 }
@@ -0,0 +1,169 @@
+package datalog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Plan of the top-down evaluation of the query, as shown by #explain.
+// Each step of the plan is a literal, with the steps needed to evaluate it:
+// the atoms have the matching rules as the steps, the rules have the literals
+// of their bodies, in the order of evaluation.
+type Plan struct {
+	// Atom, Rule, Negation, Aggregate, or Constraint
+	Literal Evaluable
+	// How the atom's matches are found: "index(_, +)" or "tree(+, _)"
+	// when the bound arguments marked with + are used for the lookup,
+	// or "scan" when all the facts and rules of the relation are read.
+	// Empty for the built-in predicates.
+	Access string
+	// Number of the facts and the rules stored for the atom's relation.
+	Facts, Rules int
+	// Estimated number of the atom's matches, used to order the body.
+	Estimate float64
+	// The atom was called with the same bound arguments before,
+	// its rules are not repeated.
+	Repeated bool
+	Steps    []*Plan
+}
+
+// Explain how the query would be evaluated top-down.
+func (db *Database) Explain(query Atom) *Plan {
+	e := explainer{db, make(map[string]bool)}
+	return e.atom(query, make(map[Var]bool))
+}
+
+type explainer struct {
+	db *Database
+	// the atoms with the bound arguments that were already explained
+	seen map[string]bool
+}
+
+func (e explainer) atom(atom Atom, bound map[Var]bool) *Plan {
+	if isBuiltin(atom.Key()) {
+		return &Plan{Literal: atom}
+	}
+	key := atom.Key()
+	alpha := adornment(atom.Args, bound)
+	p := &Plan{
+		Literal:  atom,
+		Access:   e.db.access(atom, alpha),
+		Facts:    e.db.factsCount(key),
+		Rules:    len(e.db.rules[key]),
+		Estimate: e.db.estimate(atom, bound),
+	}
+
+	id := magicName(atom.Name, alpha)
+	if e.seen[id] {
+		p.Repeated = len(e.db.rules[key]) > 0
+		return p
+	}
+	e.seen[id] = true
+
+	for _, rule := range e.db.rules[key] {
+		if len(rule.Args) != len(atom.Args) {
+			continue
+		}
+		head := make(map[Var]bool)
+		for i, arg := range rule.Args {
+			if alpha[i] == 'b' {
+				for _, v := range varsOf(arg) {
+					head[v] = true
+				}
+			}
+		}
+		rule.Body = e.db.plan(rule.Body, head)
+		p.Steps = append(p.Steps, &Plan{
+			Literal: rule,
+			Steps:   e.body(rule.Body, head),
+		})
+	}
+	return p
+}
+
+func (e explainer) body(body []Evaluable, bound map[Var]bool) []*Plan {
+	bound = cloneBound(bound)
+	var steps []*Plan
+	for _, lit := range body {
+		var step *Plan
+		switch lit := lit.(type) {
+		case Atom:
+			step = e.atom(lit, bound)
+		case Negation:
+			step = &Plan{Literal: lit}
+			if isRelation(lit.Atom) {
+				step.Steps = []*Plan{e.atom(lit.Atom, bound)}
+			}
+		case Aggregate:
+			step = &Plan{Literal: lit, Steps: e.body(lit.Body, bound)}
+		default:
+			step = &Plan{Literal: lit}
+		}
+		steps = append(steps, step)
+		for _, v := range bindsVars(lit, bound) {
+			bound[v] = true
+		}
+	}
+	return steps
+}
+
+// Describe how the matches of the atom with the adornment are found,
+// the index is chosen like by find, when the bound arguments are substituted.
+func (db *Database) access(atom Atom, alpha string) string {
+	if best := db.indexWhere(atom, func(i int) bool { return alpha[i] == 'b' }); best != nil {
+		marks := []byte(strings.Repeat("f", best.arity))
+		for _, i := range best.positions {
+			marks[i] = 'b'
+		}
+		return "index" + argsPattern(string(marks))
+	}
+	if strings.Contains(alpha, "b") {
+		return "tree" + argsPattern(alpha)
+	}
+	return "scan"
+}
+
+// Pattern like (+, _), where the bound arguments of the adornment are +.
+func argsPattern(alpha string) string {
+	var args []string
+	for _, mark := range alpha {
+		if mark == 'b' {
+			args = append(args, "+")
+		} else {
+			args = append(args, "_")
+		}
+	}
+	return "(" + strings.Join(args, ", ") + ")"
+}
+
+// Print the plan as a tree.
+func (p *Plan) String() string {
+	var b strings.Builder
+	p.write(&b, "", "")
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (p *Plan) write(b *strings.Builder, first, rest string) {
+	b.WriteString(first)
+	b.WriteString(p.describe())
+	b.WriteString("\n")
+	for i, step := range p.Steps {
+		if i == len(p.Steps)-1 {
+			step.write(b, rest+"└── ", rest+"    ")
+		} else {
+			step.write(b, rest+"├── ", rest+"│   ")
+		}
+	}
+}
+
+func (p *Plan) describe() string {
+	atom, ok := p.Literal.(Atom)
+	if !ok || isBuiltin(atom.Key()) {
+		return fmt.Sprint(p.Literal)
+	}
+	desc := fmt.Sprintf("%v  [%s, %d facts, %d rules, ~%.1f matches]", atom, p.Access, p.Facts, p.Rules, p.Estimate)
+	if p.Repeated {
+		desc += " (repeated)"
+	}
+	return desc
+}
@@ -0,0 +1,147 @@
+package datalog
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync/atomic"
+)
+
+// Index of the facts and rules of a predicate by the values of their arguments
+// at the chosen positions. Unlike the tree of Nodes, that can only be pruned
+// on the leading arguments, it finds the matches for any bound positions.
+type index struct {
+	arity     int
+	positions []int
+	// clauses having constants at all the positions, by their values
+	entries map[string][]any
+	// clauses having variables at some of the positions, they match any lookup
+	unbound []any
+	// number of the lookups answered using the index
+	hits atomic.Int64
+}
+
+// Index the predicate on the arguments at the positions (counted from zero),
+// so the queries having constants at all these positions are answered
+// using a hash lookup. Declaring the same index twice is a no-op.
+func (db *Database) Index(key Key, arity int, positions []int) {
+	positions = slices.Clone(positions)
+	slices.Sort(positions)
+	positions = slices.Compact(positions)
+	for _, ix := range db.indexes[key] {
+		if ix.arity == arity && slices.Equal(ix.positions, positions) {
+			return
+		}
+	}
+
+	ix := &index{
+		arity:     arity,
+		positions: positions,
+		entries:   make(map[string][]any),
+	}
+	for _, val := range db.clauses(key) {
+		switch val := val.(type) {
+		case Atom:
+			ix.add(val.Args, val)
+		case Rule:
+			ix.add(val.Args, val)
+		}
+	}
+	db.indexes[key] = append(db.indexes[key], ix)
+}
+
+// Create an empty database with the same indexes declared, used for storing
+// the facts derived from the database.
+func (db *Database) emptyWithIndexes() *Database {
+	other := NewDatabase()
+	other.patterns = db.patterns
+	for key, indexes := range db.indexes {
+		for _, ix := range indexes {
+			other.Index(key, ix.arity, ix.positions)
+		}
+	}
+	return other
+}
+
+// The index with the most positions that are all bound in the query, nil if there is none.
+func (db *Database) indexFor(query Atom) *index {
+	return db.indexWhere(query, func(i int) bool { return isGround(query.Args[i]) })
+}
+
+// The index of the atom's relation with the most positions, such that
+// the arguments at all of them are bound, nil if there is none.
+func (db *Database) indexWhere(atom Atom, bound func(int) bool) *index {
+	var best *index
+	for _, ix := range db.indexes[atom.Key()] {
+		if ix.arity != len(atom.Args) || !allPositions(ix.positions, bound) {
+			continue
+		}
+		if best == nil || len(ix.positions) > len(best.positions) {
+			best = ix
+		}
+	}
+	return best
+}
+
+func allPositions(positions []int, bound func(int) bool) bool {
+	for _, i := range positions {
+		if !bound(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// Key of the values at the indexed positions, false if any of them is not a constant.
+func (ix *index) key(args []any) (string, bool) {
+	vals := make([]any, len(ix.positions))
+	for i, pos := range ix.positions {
+		if !isGround(args[pos]) {
+			return "", false
+		}
+		vals[i] = args[pos]
+	}
+	return fmt.Sprintf("%#v", vals), true
+}
+
+func (ix *index) add(args []any, val any) {
+	if len(args) != ix.arity {
+		return
+	}
+	if key, ok := ix.key(args); ok {
+		ix.entries[key] = append(ix.entries[key], val)
+	} else {
+		ix.unbound = append(ix.unbound, val)
+	}
+}
+
+func (ix *index) remove(val Atom) {
+	if len(val.Args) != ix.arity {
+		return
+	}
+	equal := func(elem any) bool {
+		this, ok := elem.(Atom)
+		return ok && this.Equal(val)
+	}
+	if key, ok := ix.key(val.Args); ok {
+		ix.entries[key] = slices.DeleteFunc(ix.entries[key], equal)
+	} else {
+		ix.unbound = slices.DeleteFunc(ix.unbound, equal)
+	}
+}
+
+// Find the potential (un-unified) matches for the arguments,
+// that need to be constants at all the indexed positions,
+// call yield for each of them.
+func (ix *index) find(ctx context.Context, args []any, yield func(Evaluable)) {
+	ix.hits.Add(1)
+	key, _ := ix.key(args)
+	for _, vals := range [][]any{ix.entries[key], ix.unbound} {
+		for _, val := range vals {
+			if ctx.Err() != nil {
+				return
+			}
+			yield(val.(Evaluable))
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package datalog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestIndexFind(t *testing.T) {
+	db := NewDatabase()
+	x, y := Var{Name: "X"}, Var{Name: "Y"}
+	ab := Atom{Name: "edge", Args: []any{String("a"), String("b")}}
+	cb := Atom{Name: "edge", Args: []any{String("c"), String("b")}}
+	ac := Atom{Name: "edge", Args: []any{String("a"), String("c")}}
+	loop := Rule{
+		Atom: Atom{Name: "edge", Args: []any{x, x}},
+		Body: []Evaluable{Atom{Name: "node", Args: []any{x}}},
+	}
+	db.Assert(ab)
+	db.Assert(cb)
+	db.Index("edge", 2, []int{1})
+	// added after the index was declared
+	db.Assert(ac)
+	db.Assert(loop)
+	db.Assert(ab)
+
+	find := func(query Atom) []any {
+		var result []any
+		db.find(context.Background(), query, Vars{}, func(val Evaluable) {
+			result = append(result, val)
+		})
+		return result
+	}
+
+	query := Atom{Name: "edge", Args: []any{y, String("b")}}
+	if db.indexFor(query) == nil {
+		t.Fatal("the index was not used")
+	}
+	expected := []any{ab, cb, loop}
+	if result := find(query); !cmp.Equal(result, expected) {
+		t.Errorf("expected: %v, got: %v", expected, result)
+	}
+
+	db.Remove(cb)
+	expected = []any{ab, loop}
+	if result := find(query); !cmp.Equal(result, expected) {
+		t.Errorf("expected: %v, got: %v", expected, result)
+	}
+
+	// the second argument is not bound
+	if db.indexFor(Atom{Name: "edge", Args: []any{String("a"), y}}) != nil {
+		t.Error("the index cannot be used for unbound arguments")
+	}
+	// different arity
+	if db.indexFor(Atom{Name: "edge", Args: []any{y, String("b"), String("c")}}) != nil {
+		t.Error("the index cannot be used for different arity")
+	}
+}
+
+func TestIndexJoin(t *testing.T) {
+	db := NewDatabase()
+	db.Index("edge", 2, []int{1})
+	x, y := Var{Name: "X"}, Var{Name: "Y"}
+	db.Assert(Atom{Name: "a", Args: []any{7}})
+	db.Assert(Atom{Name: "edge", Args: []any{String("b"), 7}})
+	db.Assert(Atom{Name: "edge", Args: []any{String("c"), 8}})
+	// q(X) :- a(Y), edge(X, Y).
+	rule := Rule{
+		Atom: Atom{Name: "q", Args: []any{x}},
+		Body: []Evaluable{
+			Atom{Name: "a", Args: []any{y}},
+			Atom{Name: "edge", Args: []any{x, y}},
+		},
+	}
+	db.Assert(rule)
+	ix := db.indexes["edge"][0]
+
+	result := queryAll(t, db, Atom{Name: "q", Args: []any{x}})
+	if expected := []string{"q(b)"}; !cmp.Equal(result, expected) {
+		t.Errorf("expected: %v, got: %v", expected, result)
+	}
+	if ix.hits.Load() != 1 {
+		t.Errorf("expected the index to be used by the rule, got %d hits", ix.hits.Load())
+	}
+
+	// the joins evaluated bottom-up
+	var derived []Atom
+	err := derive(context.Background(), rule, []*Database{db, db}, func(atom Atom) {
+		derived = append(derived, atom)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := []Atom{{Name: "q", Args: []any{String("b")}}}; !cmp.Equal(derived, expected) {
+		t.Errorf("expected: %v, got: %v", expected, derived)
+	}
+	if ix.hits.Load() != 2 {
+		t.Errorf("expected the index to be used by the rule, got %d hits", ix.hits.Load())
+	}
+}
+
+func TestExplainIndexAccess(t *testing.T) {
+	db := NewDatabase()
+	db.Index("edge", 2, []int{1})
+	x, y := Var{Name: "X"}, Var{Name: "Y"}
+	db.Assert(Atom{Name: "a", Args: []any{7}})
+	db.Assert(Atom{Name: "edge", Args: []any{String("b"), 7}})
+	db.Assert(Atom{Name: "edge", Args: []any{String("c"), 8}})
+	// q(X) :- a(Y), edge(X, Y).
+	db.Assert(Rule{
+		Atom: Atom{Name: "q", Args: []any{x}},
+		Body: []Evaluable{
+			Atom{Name: "a", Args: []any{y}},
+			Atom{Name: "edge", Args: []any{x, y}},
+		},
+	})
+	query := Atom{Name: "q", Args: []any{x}}
+
+	plan := db.Explain(query)
+	// the rule is not counted as a fact
+	if plan.Facts != 0 || plan.Rules != 1 || plan.Estimate != derivedSize {
+		t.Errorf("expected 0 facts, 1 rule, and %v matches, got %d, %d, and %v",
+			derivedSize, plan.Facts, plan.Rules, plan.Estimate)
+	}
+	var access []string
+	for _, step := range plan.Steps[0].Steps {
+		access = append(access, step.Access)
+	}
+	if expected := []string{"scan", "index(_, +)"}; !cmp.Equal(access, expected) {
+		t.Errorf("expected: %v, got: %v", expected, access)
+	}
+	// the index reported by the plan is used by the evaluation
+	queryAll(t, db, query)
+	if hits := db.indexes["edge"][0].hits.Load(); hits != 1 {
+		t.Errorf("expected the index to be used, got %d hits", hits)
+	}
+}
@@ -0,0 +1,97 @@
+package datalog
+
+// The lists are compound terms, like in Prolog: [a, b] is the chain
+// of the cons cells '.'(a, '.'(b, [])), where [] is the empty list.
+const (
+	consFunctor = "."
+	nilFunctor  = "[]"
+)
+
+// Empty list.
+var Nil = Compound{Functor: nilFunctor}
+
+// Create the list of the elements followed by the tail, like [a, b | T].
+// If the tail is nil, the list ends with the empty list.
+func NewList(elems []any, tail any) any {
+	if tail == nil {
+		tail = Nil
+	}
+	for i := len(elems) - 1; i >= 0; i-- {
+		tail = Compound{Functor: consFunctor, Args: []any{elems[i], tail}}
+	}
+	return tail
+}
+
+func isCons(term any) bool {
+	c, ok := term.(Compound)
+	return ok && c.Functor == consFunctor && len(c.Args) == 2
+}
+
+func isNil(term any) bool {
+	c, ok := term.(Compound)
+	return ok && c.Functor == nilFunctor && len(c.Args) == 0
+}
+
+// Split the list into its elements and the tail that is not a cons cell,
+// the empty list for the proper lists, or e.g. a variable for the partial ones.
+func unlist(term any) ([]any, any) {
+	var elems []any
+	for isCons(term) {
+		c := term.(Compound)
+		elems = append(elems, c.Args[0])
+		term = c.Args[1]
+	}
+	return elems, term
+}
+
+// The elements of the list, if the term is a list ending with the empty list.
+func properList(term any) ([]any, bool) {
+	elems, tail := unlist(term)
+	return elems, isNil(tail)
+}
+
+func member(_ *Database, args []any, _ int, vars Vars, yield func(Vars) bool) bool {
+	elems, ok := properList(args[1])
+	if !ok {
+		return false
+	}
+	for _, elem := range elems {
+		if !yieldUnified(args[:1], []any{elem}, vars, yield) {
+			break
+		}
+	}
+	return true
+}
+
+func length(_ *Database, args []any, _ int, vars Vars, yield func(Vars) bool) bool {
+	elems, ok := properList(args[0])
+	if !ok {
+		return false
+	}
+	yieldUnified(args[1:], []any{len(elems)}, vars, yield)
+	return true
+}
+
+func appendLists(_ *Database, args []any, mode int, vars Vars, yield func(Vars) bool) bool {
+	if mode == 0 {
+		elems, ok := properList(args[0])
+		if !ok {
+			return false
+		}
+		// the second list becomes the tail, so it can be partial
+		yieldUnified(args[2:], []any{NewList(elems, args[1])}, vars, yield)
+		return true
+	}
+	elems, ok := properList(args[2])
+	if !ok {
+		return false
+	}
+	// all the ways of splitting the list
+	for i := 0; i <= len(elems); i++ {
+		parts := []any{NewList(elems[:i], nil), NewList(elems[i:], nil)}
+		if !yieldUnified(args[:2], parts, vars, yield) {
+			break
+		}
+	}
+	return true
+}
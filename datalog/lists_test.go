@@ -0,0 +1,123 @@
+package datalog
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestBuiltins(t *testing.T) {
+	list := func(elems ...any) any {
+		return NewList(elems, nil)
+	}
+	x, y := Var{Name: "X"}, Var{Name: "Y"}
+	var testCases = []struct {
+		query    Atom
+		expected []string
+	}{
+		{
+			Atom{Name: "member", Args: []any{x, list(String("a"), String("b"))}},
+			[]string{"member(a, [a, b])", "member(b, [a, b])"},
+		},
+		{
+			Atom{Name: "member", Args: []any{String("c"), list(String("a"), String("b"))}},
+			nil,
+		},
+		{
+			Atom{Name: "member", Args: []any{x, Nil}},
+			nil,
+		},
+		{
+			Atom{Name: "length", Args: []any{list(1, 2, 3), x}},
+			[]string{"length([1, 2, 3], 3)"},
+		},
+		{
+			Atom{Name: "length", Args: []any{Nil, 0}},
+			[]string{"length([], 0)"},
+		},
+		{
+			Atom{Name: "append", Args: []any{list(1), list(2, 3), x}},
+			[]string{"append([1], [2, 3], [1, 2, 3])"},
+		},
+		{
+			Atom{Name: "append", Args: []any{list(1), y, x}},
+			[]string{"append([1], Y, [1 | Y])"},
+		},
+		{
+			Atom{Name: "member", Args: []any{String("a"), NewList([]any{x, String("b")}, nil)}},
+			[]string{"member(a, [a, b])"},
+		},
+		{
+			Atom{Name: "append", Args: []any{x, y, list(1, 2)}},
+			[]string{
+				"append([1, 2], [], [1, 2])",
+				"append([1], [2], [1, 2])",
+				"append([], [1, 2], [1, 2])",
+			},
+		},
+		{
+			Atom{Name: "append", Args: []any{x, list(2), list(1, 2)}},
+			[]string{"append([1], [2], [1, 2])"},
+		},
+	}
+	for _, strategy := range []Strategy{TopDown, BottomUp} {
+		db := NewDatabase()
+		db.Strategy = strategy
+		for _, tt := range testCases {
+			result := queryAll(t, db, tt.query)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("for %v using %v expected: %v, got: %v", tt.query, strategy, tt.expected, result)
+			}
+		}
+	}
+}
+
+func TestBuiltinsErrors(t *testing.T) {
+	db := NewDatabase()
+	err := db.Assert(Atom{Name: "member", Args: []any{String("a"), NewList([]any{String("a")}, nil)}})
+	if _, ok := err.(BuiltinRedefined); !ok {
+		t.Errorf("expected an error, got: %v", err)
+	}
+
+	var testCases = []struct {
+		query    Atom
+		expected error
+	}{
+		{
+			Atom{Name: "member", Args: []any{String("a"), Var{Name: "L"}}},
+			NotBound{},
+		},
+		{
+			Atom{Name: "append", Args: []any{Var{Name: "X"}, NewList([]any{2}, nil), Var{Name: "Y"}}},
+			NotBound{},
+		},
+		{
+			Atom{Name: "member", Args: []any{String("a"), String("b")}},
+			InvalidArgs{},
+		},
+		{
+			Atom{Name: "regex_capture", Args: []any{String("a"), String("("), 0, Var{Name: "X"}}},
+			InvalidPattern{},
+		},
+		{
+			Atom{Name: "regex_capture", Args: []any{String("a"), String("(a)"), 2, Var{Name: "X"}}},
+			InvalidArgs{},
+		},
+	}
+	for _, tt := range testCases {
+		out := make(chan Result)
+		if err := db.QueryContext(context.Background(), tt.query, out); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var errs []error
+		for result := range out {
+			errs = append(errs, result.Err)
+		}
+		if len(errs) != 1 {
+			t.Fatalf("for %v expected a single result, got: %v", tt.query, errs)
+		}
+		if reflect.TypeOf(errs[0]) != reflect.TypeOf(tt.expected) {
+			t.Errorf("for %v expected %T, got: %v", tt.query, tt.expected, errs[0])
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package datalog
+
+import (
+	"context"
+	"strings"
+)
+
+// Relation with the adornment marking which of its arguments
+// are bound ("b") or free ("f") when it is called.
+type adorned struct {
+	key       Key
+	adornment string
+}
+
+// Rewrite the program needed to answer the query using the magic sets
+// transformation. Every relation defined by rules is replaced with its
+// versions specialized for the bound arguments it is called with, and their
+// rules are guarded by the "magic" relations, holding the values of the bound
+// arguments that are relevant to the query. This way, the bottom-up
+// evaluation derives only the facts that are relevant to the query.
+// The rewritten program is returned, together with the query to be asked
+// against it. If the query has no bound arguments, it is not rewritten.
+func (db *Database) magicSets(query Atom) (*Database, Atom, bool) {
+	alpha := adornment(query.Args, nil)
+	if !strings.Contains(alpha, "b") || !db.isDerived(query.Key()) {
+		return nil, Atom{}, false
+	}
+
+	prog := db.emptyWithIndexes()
+	g := db.dependencies(query.Key())
+
+	// the relations used in the negations and aggregates need to be fully
+	// computed, so they are not rewritten, the same as the stored facts
+	full := make(map[Key]bool)
+	var queue []Key
+	for key, edges := range g {
+		if !db.isDerived(key) {
+			queue = append(queue, key)
+		}
+		for _, e := range edges {
+			if e.via != "" {
+				queue = append(queue, e.to)
+			}
+		}
+	}
+	for len(queue) > 0 {
+		key := queue[0]
+		queue = queue[1:]
+		if full[key] {
+			continue
+		}
+		full[key] = true
+		for _, e := range g[key] {
+			queue = append(queue, e.to)
+		}
+		for _, val := range db.clauses(key) {
+			prog.assert(val.(HasKey))
+		}
+	}
+
+	// magic seed
+	prog.assert(Atom{
+		Name: magicName(query.Name, alpha),
+		Args: boundArgs(query.Args, alpha),
+	})
+
+	done := make(map[adorned]bool)
+	pending := []adorned{{query.Key(), alpha}}
+	for len(pending) > 0 {
+		rel := pending[0]
+		pending = pending[1:]
+		if done[rel] {
+			continue
+		}
+		done[rel] = true
+		for _, val := range db.clauses(rel.key) {
+			switch val := val.(type) {
+			case Atom:
+				if len(val.Args) == len(rel.adornment) {
+					prog.assert(Atom{
+						Name: adornedName(val.Name, rel.adornment),
+						Args: val.Args,
+					})
+				}
+			case Rule:
+				if len(val.Args) == len(rel.adornment) {
+					next := db.rewriteRule(val, rel.adornment, prog)
+					pending = append(pending, next...)
+				}
+			}
+		}
+	}
+
+	goal := Atom{
+		Name: adornedName(query.Name, alpha),
+		Args: query.Args,
+	}
+	return prog, goal, true
+}
+
+// Save the rule specialized for the adornment of its head to the program,
+// together with the magic rules for the relations it calls. The bindings are
+// passed from the left to the right, so an atom has the arguments bound
+// by the head or the atoms preceding it. Return the called relations.
+func (db *Database) rewriteRule(rule Rule, alpha string, prog *Database) []adorned {
+	var (
+		body []Evaluable
+		// the atoms preceding the current literal
+		atoms []Evaluable
+		next  []adorned
+	)
+	bound := make(map[Var]bool)
+	for i, arg := range rule.Args {
+		if alpha[i] == 'b' {
+			for _, v := range varsOf(arg) {
+				bound[v] = true
+			}
+		}
+	}
+	if strings.Contains(alpha, "b") {
+		magic := Atom{
+			Name: magicName(rule.Name, alpha),
+			Args: boundArgs(rule.Args, alpha),
+		}
+		body = append(body, magic)
+		atoms = append(atoms, magic)
+	}
+
+	for _, lit := range rule.Body {
+		atom, ok := lit.(Atom)
+		if !ok || !isRelation(atom) {
+			// the magic rules use only the atoms searched in the database
+			body = append(body, lit)
+			continue
+		}
+		if db.isDerived(atom.Key()) {
+			beta := adornment(atom.Args, bound)
+			if strings.Contains(beta, "b") {
+				magic := Atom{
+					Name: magicName(atom.Name, beta),
+					Args: boundArgs(atom.Args, beta),
+				}
+				if len(atoms) == 0 {
+					prog.assert(magic)
+				} else {
+					prog.assert(Rule{Atom: magic, Body: atoms})
+				}
+			}
+			next = append(next, adorned{atom.Key(), beta})
+			atom = Atom{
+				Name: adornedName(atom.Name, beta),
+				Args: atom.Args,
+			}
+		}
+		body = append(body, atom)
+		// copied, so the magic rules do not share it
+		atoms = append(atoms[:len(atoms):len(atoms)], atom)
+		for _, v := range varsOf(atom.Args...) {
+			bound[v] = true
+		}
+	}
+
+	prog.assert(Rule{
+		Atom: Atom{
+			Name: adornedName(rule.Name, alpha),
+			Args: rule.Args,
+		},
+		Body: body,
+	})
+	return next
+}
+
+// The relation is defined by at least one rule.
+func (db *Database) isDerived(key Key) bool {
+	return len(db.rules[key]) > 0
+}
+
+// The arguments that are constants, bound variables, or compound terms
+// with only bound variables are marked with "b", the remaining ones with "f".
+func adornment(args []any, bound map[Var]bool) string {
+	var b strings.Builder
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case Var:
+			if bound[arg] {
+				b.WriteByte('b')
+			} else {
+				b.WriteByte('f')
+			}
+		case Wildcard:
+			b.WriteByte('f')
+		case Compound:
+			if allBound(varsOf(arg), bound) {
+				b.WriteByte('b')
+			} else {
+				b.WriteByte('f')
+			}
+		default:
+			b.WriteByte('b')
+		}
+	}
+	return b.String()
+}
+
+func boundArgs(args []any, adornment string) []any {
+	var out []any
+	for i, arg := range args {
+		if adornment[i] == 'b' {
+			out = append(out, arg)
+		}
+	}
+	return out
+}
+
+// The names use dots, so they cannot clash with the names of the relations
+// defined by the user.
+func adornedName(name, adornment string) string {
+	return name + "." + adornment
+}
+
+func magicName(name, adornment string) string {
+	return "magic." + name + "." + adornment
+}
+
+// Answer the query using the bottom-up evaluation of the magic sets
+// rewritten program, send the results to the out channel.
+func (db *Database) evalMagic(ctx context.Context, prog *Database, goal Atom, query Atom, out chan<- Result) error {
+	strata, err := prog.stratify(goal.Key())
+	if err != nil {
+		close(out)
+		return err
+	}
+	store, err := prog.fixpoint(ctx, strata)
+	if err != nil {
+		close(out)
+		return err
+	}
+	ch := make(chan Result)
+	store.evalQuery(ctx, goal, ch)
+	go func() {
+		defer close(out)
+		for result := range ch {
+			if result.Err == nil {
+				result.Name = query.Name
+			}
+			send(ctx, out, result)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,61 @@
+package datalog
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestMagicSets(t *testing.T) {
+	db := NewDatabase()
+	for _, edge := range [][2]string{{"a", "b"}, {"b", "c"}, {"x", "y"}, {"y", "z"}} {
+		db.Assert(Atom{Name: "edge", Args: []any{String(edge[0]), String(edge[1])}})
+	}
+	x, y, z := Var{Name: "X"}, Var{Name: "Y"}, Var{Name: "Z"}
+	// path(X, Y) :- edge(X, Y).
+	db.Assert(Rule{
+		Atom: Atom{Name: "path", Args: []any{x, y}},
+		Body: []Evaluable{
+			Atom{Name: "edge", Args: []any{x, y}},
+		},
+	})
+	// path(X, Y) :- edge(X, Z), path(Z, Y).
+	db.Assert(Rule{
+		Atom: Atom{Name: "path", Args: []any{x, y}},
+		Body: []Evaluable{
+			Atom{Name: "edge", Args: []any{x, z}},
+			Atom{Name: "path", Args: []any{z, y}},
+		},
+	})
+
+	prog, goal, ok := db.magicSets(Atom{Name: "path", Args: []any{String("a"), x}})
+	if !ok {
+		t.Fatal("the query was not rewritten")
+	}
+	if goal.Name != "path.bf" {
+		t.Errorf("unexpected goal: %v", goal)
+	}
+	strata, err := prog.stratify(goal.Key())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	store, err := prog.fixpoint(context.Background(), strata)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var derived []string
+	for _, val := range store.clauses("path.bf") {
+		derived = append(derived, val.(Atom).String())
+	}
+	slices.Sort(derived)
+	expected := []string{"path.bf(a, b)", "path.bf(a, c)", "path.bf(b, c)"}
+	if !slices.Equal(derived, expected) {
+		t.Errorf("expected: %v, got: %v", expected, derived)
+	}
+
+	// no bound arguments
+	if _, _, ok := db.magicSets(Atom{Name: "path", Args: []any{x, y}}); ok {
+		t.Errorf("the query with free arguments should not be rewritten")
+	}
+}
@@ -1,9 +1,9 @@
 package datalog
 
 import (
+	"context"
 	"reflect"
 	"slices"
-	"sync"
 )
 
 // Node holds data in a tree structure, where the path
@@ -52,7 +52,7 @@ func (n *Node) add(args []any, val any) bool {
 		arg = args[0]
 	}
 
-	if n.Value != arg {
+	if !equal(n.Value, arg) {
 		return false
 	}
 
@@ -73,6 +73,48 @@ func (n *Node) add(args []any, val any) bool {
 	return true
 }
 
+// Check if the tree contains exactly the same value under the arguments path.
+func (n *Node) contains(args []any, val any) bool {
+	var arg any
+	switch args[0].(type) {
+	case Wildcard, Var:
+		arg = Wildcard{}
+	default:
+		arg = args[0]
+	}
+
+	if !equal(n.Value, arg) {
+		return false
+	}
+
+	if len(args) == 1 {
+		return slices.ContainsFunc(n.Next, func(elem *Node) bool {
+			return reflect.DeepEqual(elem.Value, val)
+		})
+	}
+	for _, next := range n.Next {
+		if next.contains(args[1:], val) {
+			return true
+		}
+	}
+	return false
+}
+
+// Collect all the Atoms and Rules stored in the tree.
+func (n *Node) values() []any {
+	switch n.Value.(type) {
+	case Atom, Rule:
+		if len(n.Next) == 0 {
+			return []any{n.Value}
+		}
+	}
+	var vals []any
+	for _, next := range n.Next {
+		vals = append(vals, next.values()...)
+	}
+	return vals
+}
+
 // Traverse the tree and remove the value if it exists.
 func (n *Node) remove(args []any, val Atom) {
 	if !maybeUnifies(n.Value, args[0]) {
@@ -95,32 +137,28 @@ func (n *Node) remove(args []any, val Atom) {
 }
 
 // Find all the values that match the arguments path
-// and send them to the out channel.
-func (n Node) find(args []any, out chan<- Evaluable) {
+// and call yield for each of them. The tree is traversed
+// sequentially, so yield is never called concurrently.
+func (n Node) find(ctx context.Context, args []any, yield func(Evaluable)) {
 	if len(args) == 0 {
 		// final node
 		switch val := n.Value.(type) {
 		case Atom:
-			out <- val
+			yield(val)
 		case Rule:
-			out <- val
+			yield(val)
 		}
 	} else {
-		if maybeUnifies(args[0], n.Value) {
-			var wg sync.WaitGroup
+		if ctx.Err() == nil && maybeUnifies(args[0], n.Value) {
 			for _, next := range n.Next {
-				wg.Add(1)
-				go func() {
-					defer wg.Done()
-					next.find(args[1:], out)
-				}()
+				next.find(ctx, args[1:], yield)
 			}
-			wg.Wait()
 		}
 	}
 }
 
-// The values are equal constants, or one of them is variable.
+// The values are equal constants, or one of them is variable,
+// or they are compound terms with the arguments that may unify.
 func maybeUnifies(lhs, rhs any) bool {
 	switch lhs.(type) {
 	case Var, Wildcard:
@@ -130,7 +168,11 @@ func maybeUnifies(lhs, rhs any) bool {
 	case Var, Wildcard:
 		return true
 	}
-	return rhs == lhs
+	if lhs, ok := lhs.(Compound); ok {
+		rhs, ok := rhs.(Compound)
+		return ok && lhs.Functor == rhs.Functor && slices.EqualFunc(lhs.Args, rhs.Args, maybeUnifies)
+	}
+	return equal(lhs, rhs)
 }
 
 // Delete i-th element from the slice s. It does not preserve
@@ -0,0 +1,176 @@
+package datalog
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+)
+
+// Order of the query results.
+type Order int
+
+const (
+	// The results are sent as soon as they are found,
+	// in an indeterministic order.
+	Unordered Order = iota
+	// The results are sent sorted, after all of them were found.
+	Sorted
+)
+
+func (o Order) String() string {
+	switch o {
+	case Unordered:
+		return "unordered"
+	case Sorted:
+		return "sorted"
+	default:
+		return fmt.Sprintf("Order(%d)", int(o))
+	}
+}
+
+// Semantics of the query results.
+type Semantics int
+
+const (
+	// Each distinct result is sent only once.
+	Set Semantics = iota
+	// The result is sent for each of its derivations,
+	// so the same result can be sent multiple times.
+	Bag
+)
+
+func (s Semantics) String() string {
+	switch s {
+	case Set:
+		return "set"
+	case Bag:
+		return "bag"
+	default:
+		return fmt.Sprintf("Semantics(%d)", int(s))
+	}
+}
+
+// Send the results to the out channel, skipping the ones that were already sent.
+func distinctResults(ctx context.Context, in <-chan Result, out chan<- Result) {
+	defer close(out)
+	seen := make(map[string]bool)
+	for result := range in {
+		if result.Err == nil {
+			key := fmt.Sprintf("%#v", result.Args)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		// on cancellation, the remaining results are consumed,
+		// so the goroutines can finish
+		send(ctx, out, result)
+	}
+}
+
+// Collect the results, and send them sorted to the out channel.
+// If distinct is set, the duplicated results are skipped.
+// In case of an error, only the error is sent.
+func sortResults(ctx context.Context, in <-chan Result, out chan<- Result, distinct bool) {
+	defer close(out)
+	seen := make(map[string]bool)
+	var results []Result
+	for result := range in {
+		if result.Err != nil {
+			send(ctx, out, result)
+			// consume the results, so the goroutines can finish
+			for range in {
+			}
+			return
+		}
+		if distinct {
+			key := fmt.Sprintf("%#v", result.Args)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		results = append(results, result)
+	}
+	if ctx.Err() != nil {
+		// the results are incomplete
+		return
+	}
+	slices.SortStableFunc(results, func(a, b Result) int {
+		return CompareArgs(a.Args, b.Args)
+	})
+	for _, result := range results {
+		if !send(ctx, out, result) {
+			return
+		}
+	}
+}
+
+// Compare the values using the total order, where the numbers go before
+// strings, strings before the empty list, the empty list before the other
+// compound terms, and those before the other values. The compound terms
+// are compared by the functor, and then by the arguments, so the lists
+// are compared element by element. The integers and the Floats are compared
+// by their values, and the integer goes first if the values are equal.
+func Compare(a, b any) int {
+	if c := cmp.Compare(rank(a), rank(b)); c != 0 {
+		return c
+	}
+	switch a := a.(type) {
+	case int, Float:
+		if a, b, ok := asType[int](a, b); ok {
+			return cmp.Compare(a, b)
+		}
+		lhs, rhs, _ := asFloats(a, b)
+		if c := cmp.Compare(lhs, rhs); c != 0 {
+			return c
+		}
+		return cmp.Compare(numberRank(a), numberRank(b))
+	case String:
+		return cmp.Compare(a, b.(String))
+	case Compound:
+		b := b.(Compound)
+		if c := cmp.Compare(a.Functor, b.Functor); c != 0 {
+			return c
+		}
+		return CompareArgs(a.Args, b.Args)
+	default:
+		return cmp.Compare(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
+	}
+}
+
+// The integer goes before the Float with the same value.
+func numberRank(val any) int {
+	if _, ok := val.(Float); ok {
+		return 1
+	}
+	return 0
+}
+
+func rank(val any) int {
+	switch val.(type) {
+	case int, Float:
+		return 0
+	case String:
+		return 1
+	case Compound:
+		if isNil(val) {
+			return 2
+		}
+		return 3
+	default:
+		return 4
+	}
+}
+
+// Compare the arguments one by one using Compare,
+// the shorter argument lists go first.
+func CompareArgs(a, b []any) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := Compare(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(a), len(b))
+}
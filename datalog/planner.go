@@ -0,0 +1,251 @@
+package datalog
+
+import "slices"
+
+const (
+	// fraction of the facts expected to match a bound argument
+	selectivity = 0.1
+	// assumed number of facts derived by the rules of a relation,
+	// since it is unknown before evaluating them
+	derivedSize = 1000
+)
+
+// Plan the order of evaluation of the body: at each step, the atom with
+// the smallest estimated number of matches given the variables bound so far
+// is evaluated first, and the constraints, negations, and built-in predicates
+// are evaluated as soon as their variables are bound. The aggregates are evaluated after all
+// the atoms, since the variables bound before them are the grouping keys. The literals
+// written after the aggregate do not bind its variables before it is evaluated.
+//
+// The estimate function gives the expected number of matches for the i-th
+// literal of the body. The literals over derived relations, for which barrier
+// returns true, are never moved ahead of the atoms written before them, so the
+// rules that terminate in the written order do not become left-recursive.
+// Returns the indexes of the literals in the order of evaluation.
+func planBody(
+	body []Evaluable,
+	bound map[Var]bool,
+	estimate func(i int, atom Atom, bound map[Var]bool) float64,
+	barrier func(i int) bool,
+) []int {
+	bound = cloneBound(bound)
+	placed := make([]bool, len(body))
+	var order []int
+	place := func(i int) {
+		placed[i] = true
+		order = append(order, i)
+		for _, v := range bindsVars(body[i], bound) {
+			bound[v] = true
+		}
+	}
+	// the atoms written before were already evaluated
+	inOrder := func(i int) bool {
+		if !barrier(i) {
+			return true
+		}
+		for j := 0; j < i; j++ {
+			if isRelation(body[j]) && !placed[j] {
+				return false
+			}
+		}
+		return true
+	}
+	// the variable is used by an aggregate written before the i-th
+	// literal, that was not evaluated yet
+	groups := func(i int) func(Var) bool {
+		return func(v Var) bool {
+			for j, lit := range body[:i] {
+				if agg, ok := lit.(Aggregate); ok && !placed[j] && slices.Contains(agg.localVars(), v) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	for {
+		// filters, as early as possible
+		for progress := true; progress; {
+			progress = false
+			for i, lit := range body {
+				if placed[i] {
+					continue
+				}
+				switch lit := lit.(type) {
+				case Constraint:
+					if vs, ok := lit.binds(bound); ok && !slices.ContainsFunc(vs, groups(i)) {
+						place(i)
+						progress = true
+					}
+				case Atom:
+					if b, ok := builtins[lit.Key()]; ok {
+						if vs, ok := b.binds(lit, bound); ok && !slices.ContainsFunc(vs, groups(i)) {
+							place(i)
+							progress = true
+						}
+					}
+				case Negation:
+					if allBound(varsOf(lit.Atom.Args...), bound) && inOrder(i) {
+						place(i)
+						progress = true
+					}
+				}
+			}
+		}
+
+		best, cost := -1, 0.0
+		for i, lit := range body {
+			if atom, ok := lit.(Atom); ok && isRelation(atom) && !placed[i] && inOrder(i) {
+				if c := estimate(i, atom, bound); best < 0 || c < cost {
+					best, cost = i, c
+				}
+			}
+		}
+		if best >= 0 {
+			place(best)
+			continue
+		}
+
+		next := -1
+		for i, lit := range body {
+			if _, ok := lit.(Aggregate); ok && !placed[i] {
+				next = i
+				break
+			}
+		}
+		if next >= 0 {
+			place(next)
+			continue
+		}
+
+		// the remaining ones cannot be bound, they fail when evaluated
+		for i := range body {
+			if !placed[i] {
+				order = append(order, i)
+			}
+		}
+		return order
+	}
+}
+
+// Check if the constraint can be evaluated with the bound variables.
+// For the "=" constraint that binds the variables, return them as well.
+// It binds the variable, or the variables of the compound term, on one
+// side if the other side is bound.
+func (c Constraint) binds(bound map[Var]bool) ([]Var, bool) {
+	lhs, rhs := varsOf(c.Lhs), varsOf(c.Rhs)
+	switch {
+	case allBound(lhs, bound) && allBound(rhs, bound):
+		return nil, true
+	case c.Op != "=":
+		return nil, false
+	}
+	unbound := func(vars []Var) []Var {
+		return slices.DeleteFunc(vars, func(v Var) bool { return bound[v] })
+	}
+	switch {
+	case (isVar(c.Lhs) || isCompound(c.Lhs)) && allBound(rhs, bound):
+		return unbound(lhs), true
+	case (isVar(c.Rhs) || isCompound(c.Rhs)) && allBound(lhs, bound):
+		return unbound(rhs), true
+	}
+	return nil, false
+}
+
+// Variables bound by evaluating the literal.
+func bindsVars(lit Evaluable, bound map[Var]bool) []Var {
+	switch lit := lit.(type) {
+	case Atom:
+		if b, ok := builtins[lit.Key()]; ok {
+			vs, _ := b.binds(lit, bound)
+			return vs
+		}
+		return varsOf(lit.Args...)
+	case Aggregate:
+		return varsOf(lit.Result)
+	case Constraint:
+		if vs, ok := lit.binds(bound); ok {
+			return vs
+		}
+	}
+	return nil
+}
+
+func allBound(vars []Var, bound map[Var]bool) bool {
+	for _, v := range vars {
+		if !bound[v] {
+			return false
+		}
+	}
+	return true
+}
+
+func cloneBound(bound map[Var]bool) map[Var]bool {
+	clone := make(map[Var]bool, len(bound))
+	for v := range bound {
+		clone[v] = true
+	}
+	return clone
+}
+
+// Estimate the number of facts in the database matching the atom,
+// when the bound variables are known. Their values are substituted
+// when looking up the matches, see find, so the other facts are skipped.
+func (db *Database) estimate(atom Atom, bound map[Var]bool) float64 {
+	n := float64(db.factsCount(atom.Key()))
+	if db.isDerived(atom.Key()) {
+		n += derivedSize
+	}
+	for _, arg := range atom.Args {
+		switch arg := arg.(type) {
+		case Wildcard:
+			continue
+		case Var:
+			if !bound[arg] {
+				continue
+			}
+		}
+		n *= selectivity
+	}
+	return n
+}
+
+// Number of the facts stored under the key, without the rules.
+func (db *Database) factsCount(key Key) int {
+	return db.sizes[key] - len(db.rules[key])
+}
+
+// Reorder the body of the rule for the top-down evaluation,
+// given the variables that were bound by unifying its head.
+func (db *Database) plan(body []Evaluable, bound map[Var]bool) []Evaluable {
+	return permute(body, db.planOrder(body, bound))
+}
+
+// Plan the order of evaluation of the body, return the indexes of the literals.
+func (db *Database) planOrder(body []Evaluable, bound map[Var]bool) []int {
+	return planBody(
+		body,
+		bound,
+		func(_ int, atom Atom, bound map[Var]bool) float64 {
+			return db.estimate(atom, bound)
+		},
+		func(i int) bool {
+			switch lit := body[i].(type) {
+			case Atom:
+				return db.isDerived(lit.Key())
+			case Negation:
+				return db.isDerived(lit.Atom.Key())
+			default:
+				return false
+			}
+		},
+	)
+}
+
+func permute[T any](vals []T, order []int) []T {
+	out := make([]T, len(order))
+	for i, j := range order {
+		out[i] = vals[j]
+	}
+	return out
+}
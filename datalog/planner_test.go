@@ -0,0 +1,113 @@
+package datalog
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPlan(t *testing.T) {
+	db := NewDatabase()
+	for i := 0; i < 100; i++ {
+		db.Assert(Atom{Name: "big", Args: []any{i, i + 1}})
+	}
+	for i := 0; i < 50; i++ {
+		db.Assert(Atom{Name: "mid", Args: []any{i}})
+	}
+	db.Assert(Atom{Name: "small", Args: []any{1}})
+	x, y, z, n := Var{Name: "X"}, Var{Name: "Y"}, Var{Name: "Z"}, Var{Name: "N"}
+
+	big := Atom{Name: "big", Args: []any{x, y}}
+	mid := Atom{Name: "mid", Args: []any{y}}
+	small := Atom{Name: "small", Args: []any{x}}
+	filter := Constraint{Op: "<", Lhs: x, Rhs: 10}
+	assign := Constraint{Op: "=", Lhs: z, Rhs: Expr{Op: "+", Lhs: y, Rhs: 1}}
+	negation := Negation{Atom: Atom{Name: "small", Args: []any{y}}}
+	count := Aggregate{
+		Func:   "count",
+		Result: n,
+		Body:   []Evaluable{Atom{Name: "big", Args: []any{Wildcard{}, x}}},
+	}
+
+	var testCases = []struct {
+		body     []Evaluable
+		bound    map[Var]bool
+		expected []Evaluable
+	}{
+		// the smaller relation goes first, the filter right after binding X
+		{
+			[]Evaluable{big, small, filter},
+			nil,
+			[]Evaluable{small, filter, big},
+		},
+		// X is bound by the head, so big has fewer matches
+		{
+			[]Evaluable{mid, big},
+			map[Var]bool{x: true},
+			[]Evaluable{big, mid},
+		},
+		{
+			[]Evaluable{big, mid},
+			nil,
+			[]Evaluable{mid, big},
+		},
+		// the constraints and negations as soon as their variables are bound
+		{
+			[]Evaluable{small, big, negation, assign},
+			nil,
+			[]Evaluable{small, big, negation, assign},
+		},
+		// aggregates after all the atoms
+		{
+			[]Evaluable{count, big, small},
+			nil,
+			[]Evaluable{small, big, count},
+		},
+		// the constraint cannot bind the variable used for grouping
+		{
+			[]Evaluable{big, small, Aggregate{
+				Func:   "count",
+				Result: n,
+				Body:   []Evaluable{Atom{Name: "big", Args: []any{z, Wildcard{}}}},
+			}, assign},
+			nil,
+			[]Evaluable{small, big, Aggregate{
+				Func:   "count",
+				Result: n,
+				Body:   []Evaluable{Atom{Name: "big", Args: []any{z, Wildcard{}}}},
+			}, assign},
+		},
+	}
+	for _, tt := range testCases {
+		result := db.plan(tt.body, tt.bound)
+		if !cmp.Equal(result, tt.expected) {
+			t.Errorf("for %v expected: %v, got: %v", tt.body, tt.expected, result)
+		}
+	}
+}
+
+func TestPlanKeepsRecursionInOrder(t *testing.T) {
+	db := NewDatabase()
+	for i := 0; i < 100; i++ {
+		db.Assert(Atom{Name: "edge", Args: []any{i, i + 1}})
+	}
+	x, y, z := Var{Name: "X"}, Var{Name: "Y"}, Var{Name: "Z"}
+	// path(X, Y) :- edge(X, Z), path(Z, Y).
+	db.Assert(Rule{
+		Atom: Atom{Name: "path", Args: []any{x, y}},
+		Body: []Evaluable{
+			Atom{Name: "edge", Args: []any{x, z}},
+			Atom{Name: "path", Args: []any{z, y}},
+		},
+	})
+
+	// path(Z, Y) has Y bound, but it cannot go first
+	body := []Evaluable{
+		Atom{Name: "edge", Args: []any{x, z}},
+		Atom{Name: "path", Args: []any{z, y}},
+	}
+	result := db.plan(body, map[Var]bool{y: true})
+	if !cmp.Equal(result, body) {
+		t.Errorf("expected: %v, got: %v", body, result)
+	}
+}
@@ -0,0 +1,57 @@
+package datalog
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// Pool limits the number of goroutines evaluating the query concurrently.
+// The subtree of the search (evaluation of a rule) is handed to a new
+// goroutine only if there is an idle worker, otherwise it is evaluated
+// by the goroutine that found it. Since no one waits for a worker
+// to become idle, the nested evaluations cannot deadlock.
+type pool struct {
+	workers chan struct{}
+}
+
+type poolKey struct{}
+
+// Create the pool for the query and attach it to the context.
+// If workers is zero or less, GOMAXPROCS workers are used, with a single
+// worker the evaluation is sequential.
+func withPool(ctx context.Context, workers int) context.Context {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	// the goroutine that started the query is one of the workers
+	p := &pool{workers: make(chan struct{}, workers-1)}
+	return context.WithValue(ctx, poolKey{}, p)
+}
+
+// The pool attached to the context, nil if there is none.
+func poolFrom(ctx context.Context) *pool {
+	p, _ := ctx.Value(poolKey{}).(*pool)
+	return p
+}
+
+// Run the task in a new goroutine if there is an idle worker,
+// otherwise run it in the current goroutine. The new goroutines are
+// added to the wait group. Nil pool runs all the tasks sequentially.
+func (p *pool) run(wg *sync.WaitGroup, task func()) {
+	if p == nil {
+		task()
+		return
+	}
+	select {
+	case p.workers <- struct{}{}:
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-p.workers }()
+			task()
+		}()
+	default:
+		task()
+	}
+}
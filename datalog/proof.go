@@ -0,0 +1,178 @@
+package datalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Proof of the answer, the tree of its derivation.
+type Proof struct {
+	// The stored fact, the fact derived by the rule, or the other
+	// literal of the rule's body (constraint, negation, aggregate,
+	// or built-in predicate) with the variables named as in the rule.
+	Literal Evaluable
+	// The rule used to derive the fact, nil for the stored facts
+	// and the other literals.
+	Rule *Rule
+	// Values of the rule's variables.
+	Bindings map[string]any
+	// Proofs of the literals of the rule's body, in the order they are written.
+	Steps []*Proof
+}
+
+// Stack of the proofs of the literals evaluated so far in the rule's body.
+// It is shared by the copies of Vars, so it is never modified.
+type trace struct {
+	proof *Proof
+	prev  *trace
+}
+
+func (t *trace) push(proof *Proof) *trace {
+	return &trace{proof, t}
+}
+
+// The proofs from the bottom of the stack.
+func (t *trace) proofs() []*Proof {
+	var proofs []*Proof
+	for ; t != nil; t = t.prev {
+		proofs = append(proofs, t.proof)
+	}
+	slices.Reverse(proofs)
+	return proofs
+}
+
+type proofsKey struct{}
+
+// The proofs are collected during the evaluation.
+func proving(ctx context.Context) bool {
+	return ctx.Value(proofsKey{}) != nil
+}
+
+// Query the database like QueryContext, but send the results with
+// their Proofs. The proofs are collected during the top-down evaluation,
+// so it is used regardless of the Database's Strategy. For the tabled
+// predicates, the proof of the first derivation of the answer is used.
+func (db *Database) Why(ctx context.Context, query Atom, out chan<- Result) error {
+	ctx = context.WithValue(ctx, proofsKey{}, true)
+	return db.queryContext(ctx, query, out, TopDown)
+}
+
+// Evaluate the body of the rule with an empty trace, and replace
+// the proofs of its literals with the proof of the rule. The body
+// was reordered for the evaluation, order holds the indexes of the literals.
+func (rule Rule) prove(ctx context.Context, body []Evaluable, order []int, vars Vars, db *Database, yield func(Vars) bool) {
+	// the variables of the rule were renamed using this counter
+	counter := vars.Counter
+	parent := vars.trace
+	vars.trace = nil
+
+	evalBody(ctx, body, vars, db, func(vars Vars) bool {
+		if vars.err == nil {
+			bindings := make(map[string]any)
+			for _, v := range rule.vars() {
+				bindings[v.Name] = vars.expand(Var{Name: v.Name, Counter: counter})
+			}
+			steps := make([]*Proof, len(order))
+			for i, proof := range vars.trace.proofs() {
+				steps[order[i]] = proof
+			}
+			head := rule.Atom.renameVars(Vars{Counter: counter})
+			vars.trace = parent.push(&Proof{
+				Literal:  head.ground(vars),
+				Rule:     &rule,
+				Bindings: bindings,
+				Steps:    steps,
+			})
+		}
+		return yield(vars)
+	})
+}
+
+// All the named variables used in the rule.
+func (r Rule) vars() []Var {
+	vars := varsOf(r.Args...)
+	for _, lit := range r.Body {
+		switch lit := lit.(type) {
+		case Atom:
+			vars = append(vars, varsOf(lit.Args...)...)
+		case Negation:
+			vars = append(vars, varsOf(lit.Atom.Args...)...)
+		case Constraint:
+			vars = append(vars, varsOf(lit.Lhs, lit.Rhs)...)
+		case Aggregate:
+			vars = append(vars, varsOf(lit.Result)...)
+		}
+	}
+	slices.SortFunc(vars, func(a, b Var) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return slices.Compact(vars)
+}
+
+// Print the proof as an indented tree.
+func (p *Proof) String() string {
+	var b strings.Builder
+	p.write(&b, "")
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (p *Proof) write(b *strings.Builder, indent string) {
+	b.WriteString(indent)
+	fmt.Fprint(b, p.Literal)
+	if p.Rule != nil {
+		fmt.Fprintf(b, "  by %v", *p.Rule)
+		var names []string
+		for name := range p.Bindings {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		var bindings []string
+		for _, name := range names {
+			bindings = append(bindings, fmt.Sprintf("%s = %v", name, p.Bindings[name]))
+		}
+		if len(bindings) > 0 {
+			fmt.Fprintf(b, "  with %s", strings.Join(bindings, ", "))
+		}
+	} else if isRelation(p.Literal) {
+		b.WriteString("  fact")
+	}
+	b.WriteString("\n")
+	for _, step := range p.Steps {
+		step.write(b, indent+"  ")
+	}
+}
+
+// Encode the proof as a JSON object with the fields "fact" for the facts,
+// or "literal" for the other literals, and "rule", "bindings", and "steps"
+// for the derived facts.
+func (p *Proof) MarshalJSON() ([]byte, error) {
+	type proof struct {
+		Fact     string         `json:"fact,omitempty"`
+		Literal  string         `json:"literal,omitempty"`
+		Rule     string         `json:"rule,omitempty"`
+		Bindings map[string]any `json:"bindings,omitempty"`
+		Steps    []*Proof       `json:"steps,omitempty"`
+	}
+	out := proof{Steps: p.Steps}
+	if isRelation(p.Literal) {
+		out.Fact = fmt.Sprint(p.Literal)
+	} else {
+		out.Literal = fmt.Sprint(p.Literal)
+	}
+	if p.Rule != nil {
+		out.Rule = p.Rule.String()
+		out.Bindings = make(map[string]any)
+		for name, val := range p.Bindings {
+			switch val := val.(type) {
+			case int, Float, String:
+				out.Bindings[name] = val
+			default:
+				out.Bindings[name] = fmt.Sprint(val)
+			}
+		}
+	}
+	return json.Marshal(out)
+}
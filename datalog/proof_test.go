@@ -0,0 +1,118 @@
+package datalog
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestWhy(t *testing.T) {
+	x, y, z := Var{Name: "X"}, Var{Name: "Y"}, Var{Name: "Z"}
+	newDatabase := func() *Database {
+		db := NewDatabase()
+		for _, edge := range [][2]string{{"a", "b"}, {"b", "c"}} {
+			db.Assert(Atom{Name: "edge", Args: []any{String(edge[0]), String(edge[1])}})
+		}
+		// path(X, Y) :- edge(X, Y).
+		db.Assert(Rule{
+			Atom: Atom{Name: "path", Args: []any{x, y}},
+			Body: []Evaluable{
+				Atom{Name: "edge", Args: []any{x, y}},
+			},
+		})
+		return db
+	}
+
+	// path(X, Y) :- edge(X, Z), path(Z, Y), X != Y.
+	rightRecursive := newDatabase()
+	rightRecursive.Assert(Rule{
+		Atom: Atom{Name: "path", Args: []any{x, y}},
+		Body: []Evaluable{
+			Atom{Name: "edge", Args: []any{x, z}},
+			Atom{Name: "path", Args: []any{z, y}},
+			Constraint{Op: "!=", Lhs: x, Rhs: y},
+		},
+	})
+	// the proofs do not depend on the strategy
+	rightRecursive.Strategy = BottomUp
+
+	// path(X, Y) :- path(X, Z), edge(Z, Y), X != Y.
+	leftRecursive := newDatabase()
+	leftRecursive.Table("path", 2)
+	leftRecursive.Assert(Rule{
+		Atom: Atom{Name: "path", Args: []any{x, y}},
+		Body: []Evaluable{
+			Atom{Name: "path", Args: []any{x, z}},
+			Atom{Name: "edge", Args: []any{z, y}},
+			Constraint{Op: "!=", Lhs: x, Rhs: y},
+		},
+	})
+
+	var testCases = []struct {
+		db       *Database
+		expected string
+	}{
+		{
+			rightRecursive,
+			"path(a, c)  by path(X, Y) :- edge(X, Z), path(Z, Y), X != Y  with X = a, Y = c, Z = b\n" +
+				"  edge(a, b)  fact\n" +
+				"  path(b, c)  by path(X, Y) :- edge(X, Y)  with X = b, Y = c\n" +
+				"    edge(b, c)  fact\n" +
+				"  X != Y",
+		},
+		{
+			leftRecursive,
+			"path(a, c)  by path(X, Y) :- path(X, Z), edge(Z, Y), X != Y  with X = a, Y = c, Z = b\n" +
+				"  path(a, b)  by path(X, Y) :- edge(X, Y)  with X = a, Y = b\n" +
+				"    edge(a, b)  fact\n" +
+				"  edge(b, c)  fact\n" +
+				"  X != Y",
+		},
+	}
+	for _, tt := range testCases {
+		out := make(chan Result)
+		query := Atom{Name: "path", Args: []any{String("a"), String("c")}}
+		if err := tt.db.Why(context.Background(), query, out); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var proofs []string
+		for result := range out {
+			if result.Err != nil {
+				t.Fatalf("unexpected error: %s", result.Err)
+			}
+			proofs = append(proofs, result.Proof.String())
+		}
+		if len(proofs) != 1 || proofs[0] != tt.expected {
+			t.Errorf("expected:\n%s\ngot:\n%v", tt.expected, proofs)
+		}
+	}
+}
+
+func TestProofJSON(t *testing.T) {
+	x := Var{Name: "X"}
+	rule := Rule{
+		Atom: Atom{Name: "big", Args: []any{x}},
+		Body: []Evaluable{
+			Atom{Name: "size", Args: []any{x}},
+			Constraint{Op: "!=", Lhs: x, Rhs: 10},
+		},
+	}
+	proof := &Proof{
+		Literal:  Atom{Name: "big", Args: []any{42}},
+		Rule:     &rule,
+		Bindings: map[string]any{"X": 42},
+		Steps: []*Proof{
+			{Literal: Atom{Name: "size", Args: []any{42}}},
+			{Literal: Constraint{Op: "!=", Lhs: x, Rhs: 10}},
+		},
+	}
+	data, err := json.Marshal(proof)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := `{"fact":"big(42)","rule":"big(X) :- size(X), X != 10","bindings":{"X":42},` +
+		`"steps":[{"fact":"size(42)"},{"literal":"X != 10"}]}`
+	if string(data) != expected {
+		t.Errorf("expected: %s, got: %s", expected, data)
+	}
+}
@@ -0,0 +1,286 @@
+package datalog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dependency graph of the relations, where the edges
+// lead from the heads of the rules to the relations
+// used in their bodies.
+type graph map[Key][]edge
+
+type edge struct {
+	to Key
+	// the relation is used in a negated literal or an aggregate,
+	// so it needs to be fully computed in a lower stratum
+	via string
+}
+
+// Build the dependency graph of all the relations
+// that are reachable from the key.
+func (db *Database) dependencies(key Key) graph {
+	g := make(graph)
+	queue := []Key{key}
+	for len(queue) > 0 {
+		key, queue = queue[0], queue[1:]
+		if _, ok := g[key]; ok {
+			continue
+		}
+		g[key] = nil
+		for _, rule := range db.rules[key] {
+			for _, lit := range rule.Body {
+				for _, dep := range dependsOn(lit) {
+					g[key] = append(g[key], dep)
+					queue = append(queue, dep.to)
+				}
+			}
+		}
+	}
+	return g
+}
+
+// Relations used by the literal.
+func dependsOn(lit Evaluable) []edge {
+	switch lit := lit.(type) {
+	case Atom:
+		if isBuiltin(lit.Key()) {
+			return nil
+		}
+		return []edge{{lit.Key(), ""}}
+	case Negation:
+		if isBuiltin(lit.Atom.Key()) {
+			return nil
+		}
+		return []edge{{lit.Atom.Key(), "negation"}}
+	case Aggregate:
+		var edges []edge
+		for _, lit := range lit.Body {
+			for _, e := range dependsOn(lit) {
+				edges = append(edges, edge{e.to, "aggregation"})
+			}
+		}
+		return edges
+	default:
+		return nil
+	}
+}
+
+// Split the graph into strongly connected components using
+// the Tarjan's algorithm. The components are returned in
+// the order of dependencies, so every component comes after
+// all the components it depends on.
+// See: https://en.wikipedia.org/wiki/Tarjan%27s_strongly_connected_components_algorithm
+func (g graph) components(start Key) [][]Key {
+	var (
+		index   = make(map[Key]int)
+		lowlink = make(map[Key]int)
+		onStack = make(map[Key]bool)
+		stack   []Key
+		out     [][]Key
+	)
+
+	var visit func(Key)
+	visit = func(v Key) {
+		index[v] = len(index)
+		lowlink[v] = index[v]
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, e := range g[v] {
+			w := e.to
+			if _, ok := index[w]; !ok {
+				visit(w)
+				lowlink[v] = min(lowlink[v], lowlink[w])
+			} else if onStack[w] {
+				lowlink[v] = min(lowlink[v], index[w])
+			}
+		}
+
+		if lowlink[v] == index[v] {
+			var component []Key
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				component = append(component, w)
+				if w == v {
+					break
+				}
+			}
+			out = append(out, component)
+		}
+	}
+
+	visit(start)
+	return out
+}
+
+// Find the shortest path from one key to another,
+// using only the edges within the component.
+func (g graph) path(from, to Key, component map[Key]bool) []Key {
+	prev := map[Key]Key{from: from}
+	queue := []Key{from}
+	for len(queue) > 0 {
+		key := queue[0]
+		queue = queue[1:]
+		if key == to {
+			path := []Key{key}
+			for key != from {
+				key = prev[key]
+				path = append([]Key{key}, path...)
+			}
+			return path
+		}
+		for _, e := range g[key] {
+			if _, ok := prev[e.to]; !ok && component[e.to] {
+				prev[e.to] = key
+				queue = append(queue, e.to)
+			}
+		}
+	}
+	return nil
+}
+
+// Split the relations needed to answer the query about
+// the key into strata that can be evaluated one by one.
+// Fail if the relation depends on its own negation or aggregate.
+func (db *Database) stratify(key Key) ([][]Key, error) {
+	g := db.dependencies(key)
+	strata := g.components(key)
+	for _, stratum := range strata {
+		component := make(map[Key]bool)
+		for _, key := range stratum {
+			component[key] = true
+		}
+		for _, key := range stratum {
+			for _, e := range g[key] {
+				if e.via != "" && component[e.to] {
+					cycle := append([]Key{key}, g.path(e.to, key, component)...)
+					return nil, NotStratified{e.via, cycle}
+				}
+			}
+		}
+	}
+	return strata, nil
+}
+
+// Check if all the variables used in the negated literals
+// are bound before they are evaluated.
+func (r Rule) checkSafety() error {
+	return r.checkBody(false)
+}
+
+// Check if all the variables used in the constraints and
+// negated literals are bound before they are evaluated.
+func (r Rule) checkBound() error {
+	return r.checkBody(true)
+}
+
+// Walk through the body of the rule in the order of evaluation
+// and check if the variables are bound when needed. Atoms and
+// aggregates bind the variables, as well as the "=" constraints
+// where one side is a single unbound variable, or a compound term
+// and the other side is bound, and the built-in predicates called
+// with their lists bound.
+func (r Rule) checkBody(constraints bool) error {
+	bound := make(map[Var]bool)
+	check := func(vars []Var) error {
+		for _, v := range vars {
+			if !bound[v] {
+				return UnboundVar{v, r}
+			}
+		}
+		return nil
+	}
+	for _, lit := range r.Body {
+		if atom, ok := lit.(Atom); ok && isRelation(atom) {
+			for _, v := range varsOf(atom.Args...) {
+				bound[v] = true
+			}
+		}
+	}
+	for _, lit := range r.Body {
+		switch lit := lit.(type) {
+		case Atom:
+			if b, ok := builtins[lit.Key()]; ok {
+				if _, ok := b.binds(lit, bound); !ok && constraints {
+					return check(b.modes[0].needs(lit))
+				}
+				for _, v := range varsOf(lit.Args...) {
+					bound[v] = true
+				}
+			}
+		case Aggregate:
+			for _, v := range varsOf(lit.Result) {
+				bound[v] = true
+			}
+		case Negation:
+			if err := check(varsOf(lit.Atom.Args...)); err != nil {
+				return err
+			}
+		case Constraint:
+			if lit.Op == "=" {
+				if v, ok := lit.Lhs.(Var); ok && !bound[v] {
+					bound[v] = true
+					lit.Lhs = nil
+				} else if v, ok := lit.Rhs.(Var); ok && !bound[v] {
+					bound[v] = true
+					lit.Rhs = nil
+				} else if isCompound(lit.Lhs) && check(varsOf(lit.Rhs)) == nil {
+					for _, v := range varsOf(lit.Lhs) {
+						bound[v] = true
+					}
+				} else if isCompound(lit.Rhs) && check(varsOf(lit.Lhs)) == nil {
+					for _, v := range varsOf(lit.Rhs) {
+						bound[v] = true
+					}
+				}
+			}
+			if constraints {
+				if err := check(varsOf(lit.Lhs, lit.Rhs)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// List the variables used in the terms.
+func varsOf(terms ...any) []Var {
+	var vars []Var
+	for _, term := range terms {
+		switch term := term.(type) {
+		case Var:
+			vars = append(vars, term)
+		case Expr:
+			vars = append(vars, varsOf(term.Lhs, term.Rhs)...)
+		case Compound:
+			vars = append(vars, varsOf(term.Args...)...)
+		}
+	}
+	return vars
+}
+
+type UnboundVar struct {
+	v    Var
+	rule Rule
+}
+
+func (err UnboundVar) Error() string {
+	return fmt.Sprintf("variable %v is not bound by any atom in: %v", err.v, err.rule)
+}
+
+type NotStratified struct {
+	via   string
+	cycle []Key
+}
+
+func (err NotStratified) Error() string {
+	var keys []string
+	for _, key := range err.cycle {
+		keys = append(keys, string(key))
+	}
+	return fmt.Sprintf("%s through recursion: %s", err.via, strings.Join(keys, " -> "))
+}
@@ -0,0 +1,164 @@
+package datalog
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// The built-in predicates operating on strings. The integers and
+// the Floats given as the inputs are used as strings.
+
+func cat(_ *Database, args []any, mode int, vars Vars, yield func(Vars) bool) bool {
+	if mode == 0 {
+		lhs, ok := toString(args[0])
+		if !ok {
+			return false
+		}
+		rhs, ok := toString(args[1])
+		if !ok {
+			return false
+		}
+		yieldUnified(args[2:], []any{String(lhs + rhs)}, vars, yield)
+		return true
+	}
+	str, ok := toString(args[2])
+	if !ok {
+		return false
+	}
+	// all the ways of splitting the string
+	runes := []rune(str)
+	for i := 0; i <= len(runes); i++ {
+		parts := []any{String(runes[:i]), String(runes[i:])}
+		if !yieldUnified(args[:2], parts, vars, yield) {
+			break
+		}
+	}
+	return true
+}
+
+func strlen(_ *Database, args []any, _ int, vars Vars, yield func(Vars) bool) bool {
+	str, ok := toString(args[0])
+	if !ok {
+		return false
+	}
+	yieldUnified(args[1:], []any{utf8.RuneCountInString(str)}, vars, yield)
+	return true
+}
+
+func substr(_ *Database, args []any, _ int, vars Vars, yield func(Vars) bool) bool {
+	str, ok := toString(args[0])
+	if !ok {
+		return false
+	}
+	from, ok := args[1].(int)
+	if !ok {
+		return false
+	}
+	n, ok := args[2].(int)
+	if !ok {
+		return false
+	}
+	runes := []rune(str)
+	// fails if the substring is out of the range
+	if from >= 0 && n >= 0 && from+n <= len(runes) {
+		yieldUnified(args[3:], []any{String(runes[from : from+n])}, vars, yield)
+	}
+	return true
+}
+
+func lower(_ *Database, args []any, _ int, vars Vars, yield func(Vars) bool) bool {
+	str, ok := toString(args[0])
+	if !ok {
+		return false
+	}
+	yieldUnified(args[1:], []any{String(strings.ToLower(str))}, vars, yield)
+	return true
+}
+
+func upper(_ *Database, args []any, _ int, vars Vars, yield func(Vars) bool) bool {
+	str, ok := toString(args[0])
+	if !ok {
+		return false
+	}
+	yieldUnified(args[1:], []any{String(strings.ToUpper(str))}, vars, yield)
+	return true
+}
+
+func split(_ *Database, args []any, _ int, vars Vars, yield func(Vars) bool) bool {
+	str, ok := toString(args[0])
+	if !ok {
+		return false
+	}
+	sep, ok := toString(args[1])
+	if !ok {
+		return false
+	}
+	for _, part := range strings.Split(str, sep) {
+		if !yieldUnified(args[2:], []any{String(part)}, vars, yield) {
+			break
+		}
+	}
+	return true
+}
+
+func numberOf(_ *Database, args []any, _ int, vars Vars, yield func(Vars) bool) bool {
+	str, ok := toString(args[0])
+	if !ok {
+		return false
+	}
+	// fails if it is not a number
+	if number, ok := ParseNumber(str); ok {
+		yieldUnified(args[1:], []any{number}, vars, yield)
+	}
+	return true
+}
+
+func stringOf(_ *Database, args []any, _ int, vars Vars, yield func(Vars) bool) bool {
+	str, ok := toString(args[0])
+	if !ok {
+		// the compound terms are written like they are printed
+		str = fmt.Sprint(args[0])
+	}
+	yieldUnified(args[1:], []any{String(str)}, vars, yield)
+	return true
+}
+
+func regexCapture(db *Database, args []any, _ int, vars Vars, yield func(Vars) bool) bool {
+	str, ok := toString(args[0])
+	if !ok {
+		return false
+	}
+	pattern, ok := args[1].(String)
+	if !ok {
+		return false
+	}
+	re, err := db.patterns.compile(string(pattern))
+	if err != nil {
+		yield(vars.fail(err))
+		return true
+	}
+	var group int
+	switch arg := args[2].(type) {
+	case int:
+		group = arg
+	case String:
+		group = re.SubexpIndex(string(arg))
+	default:
+		return false
+	}
+	if group < 0 || group > re.NumSubexp() {
+		return false
+	}
+	for _, match := range re.FindAllStringSubmatchIndex(str, -1) {
+		start, end := match[2*group], match[2*group+1]
+		if start < 0 {
+			// the group did not take part in the match
+			continue
+		}
+		if !yieldUnified(args[3:], []any{String(str[start:end])}, vars, yield) {
+			break
+		}
+	}
+	return true
+}
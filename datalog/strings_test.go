@@ -0,0 +1,139 @@
+package datalog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStringBuiltins(t *testing.T) {
+	x, y := Var{Name: "X"}, Var{Name: "Y"}
+	var testCases = []struct {
+		query    Atom
+		expected []string
+	}{
+		{
+			Atom{Name: "cat", Args: []any{String("foo"), String("bar"), x}},
+			[]string{"cat(foo, bar, foobar)"},
+		},
+		{
+			Atom{Name: "cat", Args: []any{String("id"), 42, x}},
+			[]string{`cat(id, 42, id42)`},
+		},
+		{
+			Atom{Name: "cat", Args: []any{x, y, String("ab")}},
+			[]string{`cat("", ab, ab)`, "cat(a, b, ab)", `cat(ab, "", ab)`},
+		},
+		{
+			Atom{Name: "cat", Args: []any{String("a"), x, String("abc")}},
+			[]string{"cat(a, bc, abc)"},
+		},
+		{
+			Atom{Name: "strlen", Args: []any{String("zażółć"), x}},
+			[]string{"strlen(zażółć, 6)"},
+		},
+		{
+			Atom{Name: "substr", Args: []any{String("datalog"), 4, 3, x}},
+			[]string{"substr(datalog, 4, 3, log)"},
+		},
+		{
+			Atom{Name: "substr", Args: []any{String("datalog"), 5, 3, x}},
+			nil,
+		},
+		{
+			Atom{Name: "lower", Args: []any{String("Hello"), x}},
+			[]string{"lower(Hello, hello)"},
+		},
+		{
+			Atom{Name: "upper", Args: []any{String("Hello"), x}},
+			[]string{"upper(Hello, HELLO)"},
+		},
+		{
+			Atom{Name: "split", Args: []any{String("a,b,c"), String(","), x}},
+			[]string{"split(\"a,b,c\", \",\", a)", "split(\"a,b,c\", \",\", b)", "split(\"a,b,c\", \",\", c)"},
+		},
+		{
+			Atom{Name: "to_number", Args: []any{String("42"), x}},
+			[]string{"to_number(42, 42)"},
+		},
+		{
+			Atom{Name: "to_number", Args: []any{String("2.5"), x}},
+			[]string{`to_number("2.5", 2.5)`},
+		},
+		{
+			Atom{Name: "to_number", Args: []any{String("abc"), x}},
+			nil,
+		},
+		{
+			Atom{Name: "to_string", Args: []any{Float(2.5), x}},
+			[]string{`to_string(2.5, "2.5")`},
+		},
+		{
+			Atom{Name: "to_string", Args: []any{NewList([]any{1, 2}, nil), x}},
+			[]string{`to_string([1, 2], "[1, 2]")`},
+		},
+		{
+			Atom{Name: "regex_capture", Args: []any{String("a=1, b=22"), String(`(\w)=(\d+)`), 2, x}},
+			[]string{`regex_capture("a=1, b=22", "(\w)=(\d+)", 2, 1)`, `regex_capture("a=1, b=22", "(\w)=(\d+)", 2, 22)`},
+		},
+		{
+			Atom{Name: "regex_capture", Args: []any{String("x-y"), String(`(?P<first>\w)-`), String("first"), x}},
+			[]string{`regex_capture("x-y", "(?P<first>\w)-", first, x)`},
+		},
+		{
+			Atom{Name: "regex_capture", Args: []any{String("abc"), String(`\d`), 0, x}},
+			nil,
+		},
+	}
+	for _, strategy := range []Strategy{TopDown, BottomUp} {
+		db := NewDatabase()
+		db.Strategy = strategy
+		for _, tt := range testCases {
+			result := queryAll(t, db, tt.query)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("for %v using %v expected: %v, got: %v", tt.query, strategy, tt.expected, result)
+			}
+		}
+	}
+}
+
+func TestPatternsCompiledOnce(t *testing.T) {
+	db := NewDatabase()
+	db.Strategy = BottomUp
+	x, p := Var{Name: "X"}, Var{Name: "P"}
+	db.Assert(Atom{Name: "name", Args: []any{String("alice")}})
+	db.Assert(Atom{Name: "pattern", Args: []any{String("^b")}})
+	// short(X) :- name(X), X matches "^[a-z]{1,5}$".
+	db.Assert(Rule{
+		Atom: Atom{Name: "short", Args: []any{x}},
+		Body: []Evaluable{
+			Atom{Name: "name", Args: []any{x}},
+			Constraint{Op: "matches", Lhs: x, Rhs: String("^[a-z]{1,5}$")},
+		},
+	})
+	// any(X) :- name(X), pattern(P), X matches P.
+	db.Assert(Rule{
+		Atom: Atom{Name: "any", Args: []any{x}},
+		Body: []Evaluable{
+			Atom{Name: "name", Args: []any{x}},
+			Atom{Name: "pattern", Args: []any{p}},
+			Constraint{Op: "matches", Lhs: x, Rhs: p},
+		},
+	})
+	if n := len(db.patterns.compiled); n != 1 {
+		t.Errorf("expected the constant pattern to be compiled, got %d patterns", n)
+	}
+	if db.emptyWithIndexes().patterns != db.patterns {
+		t.Error("the compiled patterns are not shared with the derived facts")
+	}
+
+	if result := queryAll(t, db, Atom{Name: "short", Args: []any{x}}); !reflect.DeepEqual(result, []string{"short(alice)"}) {
+		t.Errorf("unexpected result: %v", result)
+	}
+	if result := queryAll(t, db, Atom{Name: "any", Args: []any{x}}); result != nil {
+		t.Errorf("unexpected result: %v", result)
+	}
+	// the patterns known only when evaluating are not cached
+	if n := len(db.patterns.compiled); n != 1 {
+		t.Errorf("expected one compiled pattern, got %d", n)
+	}
+}
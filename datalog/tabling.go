@@ -0,0 +1,258 @@
+package datalog
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Predicate identified by the name and arity.
+type predicate struct {
+	key   Key
+	arity int
+}
+
+// Table the predicate: during the top-down evaluation, the answers
+// for each call pattern are computed once, to a fixpoint, and reused
+// by the repeated calls. This makes the left-recursive rules terminate
+// and avoids re-deriving the same subgoals over and over.
+func (db *Database) Table(key Key, arity int) {
+	db.tabled[predicate{key, arity}] = true
+}
+
+func (db *Database) isTabled(query Atom) bool {
+	return db.tabled[predicate{query.Key(), len(query.Args)}]
+}
+
+// Tables of the answers, created for a single query. The tables are
+// evaluated using the linear tabling approach: the first call for
+// a strongly connected component of the relations becomes its leader,
+// that re-evaluates all the calls for the component until no new answers
+// are found. The calls repeated during the evaluation consume the answers
+// found so far instead of evaluating the rules again.
+type tables struct {
+	mu      sync.Mutex
+	entries map[string]*table
+	// index of the strongly connected component of each relation
+	components map[Key]int
+	// only one leader per component can evaluate at a time
+	locks []chan struct{}
+}
+
+type table struct {
+	call    Atom
+	answers []Atom
+	// proofs of the answers, if collected
+	proofs []*Proof
+	seen   map[string]bool
+	err    error
+	// all the answers were found
+	complete bool
+	// the last iteration of the leader when the call was evaluated
+	round int
+}
+
+// Leader evaluating the tables of the component, the leaders form
+// a chain following the nested calls.
+type leader struct {
+	component int
+	iteration int
+	changed   bool
+	err       error
+	tables    []*table
+	parent    *leader
+}
+
+type (
+	tablesKey struct{}
+	leaderKey struct{}
+)
+
+// Create the tables for evaluating the query over the relations
+// in the strata and attach them to the context.
+func (db *Database) withTables(ctx context.Context, strata [][]Key) context.Context {
+	if len(db.tabled) == 0 {
+		return ctx
+	}
+	ts := &tables{
+		entries:    make(map[string]*table),
+		components: make(map[Key]int),
+	}
+	for i, stratum := range strata {
+		for _, key := range stratum {
+			ts.components[key] = i
+		}
+		ts.locks = append(ts.locks, make(chan struct{}, 1))
+	}
+	return context.WithValue(ctx, tablesKey{}, ts)
+}
+
+func tablesFrom(ctx context.Context) *tables {
+	ts, _ := ctx.Value(tablesKey{}).(*tables)
+	return ts
+}
+
+func leaderFrom(ctx context.Context) *leader {
+	l, _ := ctx.Value(leaderKey{}).(*leader)
+	return l
+}
+
+// Find the leader of the component in the chain.
+func (l *leader) find(component int) *leader {
+	for ; l != nil; l = l.parent {
+		if l.component == component {
+			return l
+		}
+	}
+	return nil
+}
+
+// Answer the query using the tables and pass the matched
+// variable substitutions to yield.
+func (ts *tables) eval(ctx context.Context, query Atom, vars Vars, db *Database, yield func(Vars) bool) {
+	call := query.ground(vars)
+	answers, proofs, err := ts.answers(ctx, call, db)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		yield(vars.fail(err))
+		return
+	}
+	vars.Counter++
+	for i, answer := range answers {
+		if ctx.Err() != nil {
+			return
+		}
+		var proof *Proof
+		if proofs != nil {
+			proof = proofs[i]
+		}
+		query.unifyFact(answer, proof, vars, yield)
+	}
+}
+
+// Get the answers for the call. If they are not complete yet, and
+// the call's component is evaluated by a leader in this chain, return
+// the answers found so far, otherwise become the leader and find them all.
+// The proofs of the answers are returned, if they are collected.
+func (ts *tables) answers(ctx context.Context, call Atom, db *Database) ([]Atom, []*Proof, error) {
+	id := fmt.Sprintf("%#v", call)
+	component, ok := ts.components[call.Key()]
+	if !ok {
+		panic(fmt.Sprintf("%v is not a part of the query", call))
+	}
+
+	ts.mu.Lock()
+	t, ok := ts.entries[id]
+	if ok && t.complete {
+		ts.mu.Unlock()
+		return t.answers, t.proofs, t.err
+	}
+	if l := leaderFrom(ctx).find(component); l != nil {
+		if !ok {
+			t = newTable(call)
+			ts.entries[id] = t
+			l.tables = append(l.tables, t)
+		}
+		if t.round < l.iteration {
+			t.round = l.iteration
+			ts.mu.Unlock()
+			ts.evalRound(ctx, t, l, db)
+			ts.mu.Lock()
+		}
+		defer ts.mu.Unlock()
+		return t.answers, t.proofs, t.err
+	}
+	ts.mu.Unlock()
+
+	select {
+	case ts.locks[component] <- struct{}{}:
+		defer func() { <-ts.locks[component] }()
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+
+	ts.mu.Lock()
+	t, ok = ts.entries[id]
+	if ok && t.complete {
+		// completed by the other leader while waiting
+		ts.mu.Unlock()
+		return t.answers, t.proofs, t.err
+	}
+	l := &leader{
+		component: component,
+		parent:    leaderFrom(ctx),
+	}
+	if !ok {
+		t = newTable(call)
+		ts.entries[id] = t
+	}
+	l.tables = append(l.tables, t)
+	ts.mu.Unlock()
+
+	ctx = context.WithValue(ctx, leaderKey{}, l)
+	for {
+		ts.mu.Lock()
+		l.iteration++
+		l.changed = false
+		t.round = l.iteration
+		ts.mu.Unlock()
+
+		ts.evalRound(ctx, t, l, db)
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		ts.mu.Lock()
+		if !l.changed || l.err != nil {
+			break
+		}
+		ts.mu.Unlock()
+	}
+	defer ts.mu.Unlock()
+	for _, t := range l.tables {
+		t.complete = true
+	}
+	if t.err == nil {
+		t.err = l.err
+	}
+	return t.answers, t.proofs, t.err
+}
+
+func newTable(call Atom) *table {
+	return &table{
+		call: call,
+		seen: make(map[string]bool),
+	}
+}
+
+// Evaluate the rules matching the call once and add the new answers to the table.
+func (ts *tables) evalRound(ctx context.Context, t *table, l *leader, db *Database) {
+	t.call.resolve(ctx, Vars{}, db, func(vars Vars) bool {
+		ts.mu.Lock()
+		defer ts.mu.Unlock()
+		if vars.err != nil {
+			if t.err == nil {
+				t.err = vars.err
+			}
+			if l.err == nil {
+				l.err = vars.err
+			}
+		} else {
+			answer := t.call.ground(vars)
+			id := fmt.Sprintf("%#v", answer.Args)
+			if !t.seen[id] {
+				t.seen[id] = true
+				// the consumers hold the slices of the previous answers,
+				// appending does not modify them
+				t.answers = append(t.answers, answer)
+				if vars.trace != nil {
+					t.proofs = append(t.proofs, vars.trace.proof)
+				}
+				l.changed = true
+			}
+		}
+		return ctx.Err() == nil
+	})
+}
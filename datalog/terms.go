@@ -0,0 +1,143 @@
+package datalog
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Compound term, like point(1, 2), used as an argument.
+type Compound struct {
+	Functor string
+	Args    []any
+}
+
+// Maximal nesting of the compound terms in the derived facts,
+// so the recursive rules building the terms fail instead of
+// running forever.
+const maxDepth = 100
+
+func (c Compound) String() string {
+	if isCons(c) || isNil(c) {
+		elems, tail := unlist(c)
+		if isNil(tail) {
+			return fmt.Sprintf("[%v]", stringify(elems))
+		}
+		return fmt.Sprintf("[%v | %v]", stringify(elems), tail)
+	}
+	return fmt.Sprintf("%s(%v)", c.Functor, stringify(c.Args))
+}
+
+// The values are equal, the compound terms are compared
+// by their structure.
+func equal(lhs, rhs any) bool {
+	if lhs, ok := lhs.(Compound); ok {
+		rhs, ok := rhs.(Compound)
+		return ok && lhs.Functor == rhs.Functor && slices.EqualFunc(lhs.Args, rhs.Args, equal)
+	}
+	if _, ok := rhs.(Compound); ok {
+		return false
+	}
+	return lhs == rhs
+}
+
+// Nesting of the compound terms, zero for the other values.
+func depth(term any) int {
+	c, ok := term.(Compound)
+	if !ok {
+		return 0
+	}
+	max := 0
+	for _, arg := range c.Args {
+		if d := depth(arg); d > max {
+			max = d
+		}
+	}
+	return max + 1
+}
+
+// Unify the compound terms argument by argument.
+func (v *Vars) unifyCompound(lhs, rhs Compound) bool {
+	if lhs.Functor != rhs.Functor || len(lhs.Args) != len(rhs.Args) {
+		return false
+	}
+	for i := range lhs.Args {
+		if !v.Unify(lhs.Args[i], rhs.Args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Occurs check: the variable is used in the term, so binding
+// the variable to the term would create an infinite term.
+func (v Vars) occurs(key Var, term any) bool {
+	switch term := v.expand(term).(type) {
+	case Var:
+		return term == key
+	case Compound:
+		for _, arg := range term.Args {
+			if v.occurs(key, arg) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c Compound) renameVars(vars Vars) Compound {
+	var args []any
+	for _, arg := range c.Args {
+		args = append(args, renameTerm(arg, vars))
+	}
+	return Compound{Functor: c.Functor, Args: args}
+}
+
+// The compound term has no variables, so it can be compared
+// and stored like the other constants.
+func isGround(term any) bool {
+	switch term := term.(type) {
+	case Var, Wildcard:
+		return false
+	case Compound:
+		for _, arg := range term.Args {
+			if !isGround(arg) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Nesting of the terms in the atom.
+func (a Atom) depth() int {
+	max := 0
+	for _, arg := range a.Args {
+		if d := depth(arg); d > max {
+			max = d
+		}
+	}
+	return max
+}
+
+func hasCompound(args []any) bool {
+	return slices.ContainsFunc(args, isCompound)
+}
+
+// Evaluate the rule with the head building compound terms, and fail
+// when the derived terms are nested too deep.
+func checkDepth(head Atom, yield func(Vars) bool, eval func(func(Vars) bool)) {
+	eval(func(vars Vars) bool {
+		if vars.err == nil && head.ground(vars).depth() > maxDepth {
+			vars = vars.fail(TooDeep{head.Name})
+		}
+		return yield(vars)
+	})
+}
+
+type TooDeep struct {
+	name string
+}
+
+func (err TooDeep) Error() string {
+	return fmt.Sprintf("terms derived for %s are nested deeper than %d levels", err.name, maxDepth)
+}
@@ -1,18 +1,24 @@
 package datalog
 
 import (
+	"context"
 	"fmt"
 	"slices"
+	"strconv"
 	"strings"
 	"unicode"
 )
 
 type Const interface {
-	~string | ~int
+	~string | ~int | ~float64
 }
 
 type (
-	String   string
+	String string
+	// Floating-point number. It is a different value than the integer
+	// with the same value, so 1 and 1.0 do not unify and are not equal,
+	// but they are ordered by their values by <, <=, >, and >=.
+	Float    float64
 	Wildcard struct{}
 )
 
@@ -38,8 +44,29 @@ type Constraint struct {
 	Lhs, Rhs any
 }
 
+// Arithmetic expression, the Lhs is nil for the unary minus.
+type Expr struct {
+	Op       string
+	Lhs, Rhs any
+}
+
+// Negation is satisfied if the atom cannot be proven.
+type Negation struct {
+	Atom Atom
+}
+
+// Aggregate computes the value like count, sum, min, or max over
+// all the distinct solutions of the body and unifies it with the result.
+// See: https://souffle-lang.github.io/aggregates
+type Aggregate struct {
+	Func   string
+	Result any
+	Term   any
+	Body   []Evaluable
+}
+
 type Evaluable interface {
-	Eval(Vars, Database, chan<- Vars)
+	Eval(context.Context, Vars, *Database, chan<- Vars)
 }
 
 type Assertion struct {
@@ -54,8 +81,19 @@ type Query struct {
 	Query Atom
 }
 
+// Result of the query, either the matched Atom
+// or the error that stopped the evaluation.
+type Result struct {
+	Atom
+	Err error
+	// Proof of the result, if it was asked for, see Database.Why.
+	Proof *Proof
+	// Plan of the query, if it was asked for, see Database.Explain.
+	Plan *Plan
+}
+
 func (lhs Atom) Equal(rhs Atom) bool {
-	return lhs.Name == rhs.Name && slices.Equal(lhs.Args, rhs.Args)
+	return lhs.Name == rhs.Name && slices.EqualFunc(lhs.Args, rhs.Args, equal)
 }
 
 func (a Atom) String() string {
@@ -70,6 +108,24 @@ func (c Constraint) String() string {
 	return fmt.Sprintf("%v %s %v", c.Lhs, c.Op, c.Rhs)
 }
 
+func (e Expr) String() string {
+	if e.Lhs == nil {
+		return fmt.Sprintf("%s%v", e.Op, e.Rhs)
+	}
+	return fmt.Sprintf("(%v %s %v)", e.Lhs, e.Op, e.Rhs)
+}
+
+func (n Negation) String() string {
+	return fmt.Sprintf("!%v", n.Atom)
+}
+
+func (a Aggregate) String() string {
+	if a.Func == "count" {
+		return fmt.Sprintf("%v = %s : { %v }", a.Result, a.Func, stringify(a.Body))
+	}
+	return fmt.Sprintf("%v = %s %v : { %v }", a.Result, a.Func, a.Term, stringify(a.Body))
+}
+
 func (w Wildcard) String() string {
 	return "_"
 }
@@ -89,6 +145,36 @@ func (s String) String() string {
 	return fmt.Sprintf("\"%s\"", str)
 }
 
+// Print the number so it is read back as a Float, like 1.0 rather than 1.
+func (f Float) String() string {
+	str := strconv.FormatFloat(float64(f), 'g', -1, 64)
+	if !strings.ContainsAny(str, ".eIN") {
+		str += ".0"
+	}
+	return str
+}
+
+// The Floats differ from the integers when the values are
+// formatted with %#v, e.g. as the keys of the sets.
+func (f Float) GoString() string {
+	return fmt.Sprintf("datalog.Float(%s)", f)
+}
+
+// Parse the integer, or the floating-point number like 3.14 or 1e-3.
+func ParseNumber(str string) (any, bool) {
+	if integer, err := strconv.Atoi(str); err == nil {
+		return integer, true
+	}
+	// not the special values like "inf" or "NaN"
+	if digits := strings.TrimLeft(str, "+-"); len(digits) == 0 || digits[0] < '0' || digits[0] > '9' {
+		return nil, false
+	}
+	if float, err := strconv.ParseFloat(str, 64); err == nil {
+		return Float(float), true
+	}
+	return nil, false
+}
+
 func stringify[T any](vals []T) string {
 	var elems []string
 	for _, val := range vals {
@@ -1,9 +1,15 @@
 package datalog
 
+import "slices"
+
 // Variables substitutions mapping to be used during unification.
 type Vars struct {
 	Counter uint
 	Mapping []Mapping
+	// error that stopped the evaluation
+	err error
+	// proofs of the literals evaluated so far, if collected
+	trace *trace
 }
 
 type Mapping struct {
@@ -13,9 +19,15 @@ type Mapping struct {
 
 // Unify the two values and return the status.
 // When unifying with variables, store the
-// substitution.
+// substitution. Compound terms are unified
+// structurally.
 func (v *Vars) Unify(lhs, rhs any) bool {
-	if lhs == rhs {
+	if lhs, ok := lhs.(Compound); ok {
+		if rhs, ok := rhs.(Compound); ok {
+			return v.unifyCompound(lhs, rhs)
+		}
+	}
+	if equal(lhs, rhs) {
 		return true
 	}
 	if _, ok := lhs.(Wildcard); ok {
@@ -42,7 +54,14 @@ func (v *Vars) unifyVar(key Var, val any) bool {
 			val = newVal
 		}
 	}
-	v.Mapping = append(v.Mapping, Mapping{
+	if _, ok := val.(Compound); ok && v.occurs(key, val) {
+		return false
+	}
+	// the copies of Vars share the underlying array, so limit the capacity
+	// to force append to copy it, otherwise concurrent evaluations could
+	// overwrite each other's substitutions
+	n := len(v.Mapping)
+	v.Mapping = append(v.Mapping[:n:n], Mapping{
 		Key: key,
 		Val: val,
 	})
@@ -73,8 +92,18 @@ func (v Vars) Get(key Var) (any, bool) {
 	return nil, false
 }
 
+// Mark the substitutions as failed with the error,
+// so it gets passed to the caller.
+func (v Vars) fail(err error) Vars {
+	v.err = err
+	return v
+}
+
 // Substitute all the variables with corresponding values.
 func (v *Vars) substitute() {
+	// the substitutions are modified in-place, so they
+	// cannot share the memory with the other copies
+	v.Mapping = slices.Clone(v.Mapping)
 	for last := len(v.Mapping) - 1; last > 0; last-- {
 		new := v.Mapping[last]
 		for i := last - 1; i >= 0; i-- {
@@ -86,6 +115,30 @@ func (v *Vars) substitute() {
 	}
 }
 
+// The variables used in the body that have values.
+func (vars Vars) bound(body []Evaluable) map[Var]bool {
+	bound := make(map[Var]bool)
+	for _, lit := range body {
+		var terms []any
+		switch lit := lit.(type) {
+		case Atom:
+			terms = lit.Args
+		case Negation:
+			terms = lit.Atom.Args
+		case Constraint:
+			terms = []any{lit.Lhs, lit.Rhs}
+		case Aggregate:
+			terms = []any{lit.Result}
+		}
+		for _, v := range varsOf(terms...) {
+			if _, ok := vars.expand(v).(Var); !ok {
+				bound[v] = true
+			}
+		}
+	}
+	return bound
+}
+
 // "Rename" the variable to avoid name clashes
 // in the substitutions table.
 func (vars Vars) rename(val any) any {
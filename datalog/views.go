@@ -0,0 +1,314 @@
+package datalog
+
+import "context"
+
+// Materialized relations, with all their facts derived in advance
+// and maintained incrementally when the stored facts change.
+type views struct {
+	// the relations that were asked to be materialized
+	roots []Key
+	// strata of the roots and all the relations they depend on,
+	// in the order of dependencies
+	strata [][]Key
+	keys   map[Key]bool
+	// all the facts of the relations in the strata
+	store *Database
+}
+
+// Facts added and removed by the change, for each of the relations.
+type changes struct {
+	added, removed *Database
+}
+
+// Materialize the relation: derive all its facts, and the facts of the relations
+// it depends on, and answer its queries using them, regardless of the Strategy.
+// After a fact is asserted or removed, only the derived facts affected by the
+// change are updated, using the Delete and Rederive (DRed) algorithm: the facts
+// that might have lost their derivations are removed, those that still can be
+// derived are restored, and the new facts are derived semi-naively. The strata
+// using the changed relations in negations or aggregates are derived again.
+// Asserting a rule for the materialized relations derives all the facts again.
+func (db *Database) Materialize(key Key) error {
+	prev := db.views
+	var roots []Key
+	if prev != nil {
+		roots = prev.roots
+	}
+	if err := db.materialize(append(roots, key)); err != nil {
+		db.views = prev
+		return err
+	}
+	return nil
+}
+
+// Derive all the facts of the materialized relations from scratch.
+// On failure, no relations are materialized.
+func (db *Database) materialize(roots []Key) error {
+	db.views = nil
+	v := &views{keys: make(map[Key]bool)}
+	for _, root := range roots {
+		strata, err := db.stratify(root)
+		if err != nil {
+			return err
+		}
+		v.roots = append(v.roots, root)
+		for _, stratum := range strata {
+			// the components do not depend on the roots, so the shared ones
+			// are the same, and the new ones depend only on those before them
+			if v.keys[stratum[0]] {
+				continue
+			}
+			for _, key := range stratum {
+				v.keys[key] = true
+			}
+			v.strata = append(v.strata, stratum)
+		}
+	}
+	store, err := db.fixpoint(context.Background(), v.strata)
+	if err != nil {
+		return err
+	}
+	v.store = store
+	db.views = v
+	return nil
+}
+
+func (db *Database) isMaterialized(key Key) bool {
+	return db.views != nil && db.views.keys[key]
+}
+
+// Update the materialized relations after the value was asserted or removed.
+// On failure, the relations are no longer materialized.
+func (db *Database) maintain(val HasKey, added bool) error {
+	if !db.isMaterialized(val.Key()) {
+		return nil
+	}
+	fact, ok := val.(Atom)
+	if !ok {
+		// the rule changes the strata
+		return db.materialize(db.views.roots)
+	}
+
+	v := db.views
+	c := changes{NewDatabase(), NewDatabase()}
+	switch {
+	case added && !v.store.contains(fact):
+		c.added.insert(fact)
+	case !added && v.store.contains(fact):
+		c.removed.insert(fact)
+	default:
+		return nil
+	}
+	ctx := context.Background()
+	for _, stratum := range v.strata {
+		if err := db.updateStratum(ctx, stratum, v.store, c); err != nil {
+			db.views = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// Update the facts of the stratum in the store given the changes
+// of the lower strata and the stored facts of the stratum, and add
+// the resulting changes of the stratum to them.
+func (db *Database) updateStratum(ctx context.Context, stratum []Key, store *Database, c changes) error {
+	var rules []Rule
+	inStratum := make(map[Key]bool)
+	for _, key := range stratum {
+		inStratum[key] = true
+		rules = append(rules, db.rules[key]...)
+	}
+
+	changed := func(key Key) bool {
+		return c.added.sizes[key] > 0 || c.removed.sizes[key] > 0
+	}
+	for _, rule := range rules {
+		for _, lit := range rule.Body {
+			if _, ok := lit.(Atom); ok {
+				continue
+			}
+			for _, dep := range dependsOn(lit) {
+				if changed(dep.to) {
+					return db.recomputeStratum(ctx, stratum, store, c)
+				}
+			}
+		}
+	}
+
+	// delete all the facts derived using the removed facts, the removed facts of
+	// the lower strata are restored meanwhile, so the derivations can be found
+	var restored []Atom
+	deleted := NewDatabase()
+	for _, fact := range facts(c.removed) {
+		switch {
+		case inStratum[fact.Key()]:
+			deleted.insert(fact)
+		case !store.contains(fact):
+			restored = append(restored, fact)
+			store.insert(fact)
+		}
+	}
+	delta := c.removed
+	for hasFacts(delta) {
+		next := NewDatabase()
+		err := deriveChanges(ctx, rules, store, delta, func(atom Atom) {
+			if store.contains(atom) && deleted.insert(atom) {
+				next.insert(atom)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		delta = next
+	}
+	for _, fact := range restored {
+		store.Remove(fact)
+	}
+	for _, fact := range facts(deleted) {
+		store.Remove(fact)
+	}
+
+	// restore the deleted facts that still can be derived, they are
+	// derived again together with the added facts
+	delta = NewDatabase()
+	delta.merge(c.added)
+	for _, fact := range facts(deleted) {
+		ok, err := db.derivable(ctx, fact, store)
+		if err != nil {
+			return err
+		}
+		if ok {
+			delta.insert(fact)
+		}
+	}
+	for _, fact := range facts(delta) {
+		if inStratum[fact.Key()] {
+			store.insert(fact)
+		}
+	}
+	var inserted []Atom
+	for hasFacts(delta) {
+		next := NewDatabase()
+		err := deriveChanges(ctx, rules, store, delta, func(atom Atom) {
+			if !store.contains(atom) {
+				next.insert(atom)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		store.merge(next)
+		inserted = append(inserted, facts(next)...)
+		delta = next
+	}
+
+	for _, fact := range facts(deleted) {
+		if !store.contains(fact) {
+			c.removed.insert(fact)
+		}
+	}
+	for _, fact := range inserted {
+		if !deleted.contains(fact) {
+			c.added.insert(fact)
+		}
+	}
+	return nil
+}
+
+// Derive the facts of the stratum from scratch and record the differences.
+func (db *Database) recomputeStratum(ctx context.Context, stratum []Key, store *Database, c changes) error {
+	old := NewDatabase()
+	for _, key := range stratum {
+		for _, val := range store.clauses(key) {
+			old.insert(val.(Atom))
+		}
+	}
+	for _, fact := range facts(old) {
+		store.Remove(fact)
+	}
+	if err := db.evalStratum(ctx, stratum, store); err != nil {
+		return err
+	}
+	for _, fact := range facts(old) {
+		if !store.contains(fact) {
+			c.removed.insert(fact)
+		}
+	}
+	for _, key := range stratum {
+		for _, val := range store.clauses(key) {
+			if fact := val.(Atom); !old.contains(fact) {
+				c.added.insert(fact)
+			}
+		}
+	}
+	return nil
+}
+
+// Evaluate the rules, so that one of the atoms in the body matches
+// the facts in delta, and all the other literals match the store.
+func deriveChanges(ctx context.Context, rules []Rule, store, delta *Database, emit func(Atom)) error {
+	for _, rule := range rules {
+		for i, lit := range rule.Body {
+			if atom, ok := lit.(Atom); !ok || delta.sizes[atom.Key()] == 0 {
+				continue
+			}
+			sources := make([]*Database, len(rule.Body))
+			for j := range sources {
+				sources[j] = store
+			}
+			sources[i] = delta
+			if err := derive(ctx, rule, sources, emit); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Check if the fact is stored, or can be derived using a single rule from the facts in store.
+func (db *Database) derivable(ctx context.Context, fact Atom, store *Database) (bool, error) {
+	if db.contains(fact) {
+		return true, nil
+	}
+	for _, rule := range db.rules[fact.Key()] {
+		ok, vars := Vars{}.unifyAll(rule.Args, fact.Args)
+		if !ok {
+			continue
+		}
+		sources := make([]*Database, len(rule.Body))
+		for i := range sources {
+			sources[i] = store
+		}
+		found := false
+		err := deriveFrom(ctx, rule, sources, vars, func(Atom) {
+			found = true
+		})
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+// All the facts stored in the database.
+func facts(db *Database) []Atom {
+	var atoms []Atom
+	for key := range db.nodes {
+		for _, val := range db.clauses(key) {
+			if atom, ok := val.(Atom); ok {
+				atoms = append(atoms, atom)
+			}
+		}
+	}
+	return atoms
+}
+
+func hasFacts(db *Database) bool {
+	for _, n := range db.sizes {
+		if n > 0 {
+			return true
+		}
+	}
+	return false
+}
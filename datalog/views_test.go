@@ -0,0 +1,158 @@
+package datalog
+
+import (
+	"context"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// Query the database and return the sorted results.
+func queryAll(t *testing.T, db *Database, query Atom) []string {
+	t.Helper()
+	out := make(chan Result)
+	if err := db.QueryContext(context.Background(), query, out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var results []string
+	for result := range out {
+		if result.Err != nil {
+			t.Fatalf("unexpected error: %s", result.Err)
+		}
+		results = append(results, result.Atom.String())
+	}
+	slices.Sort(results)
+	return results
+}
+
+func TestMaterialize(t *testing.T) {
+	db := NewDatabase()
+	for _, edge := range [][2]string{{"a", "b"}, {"b", "c"}, {"c", "d"}, {"a", "c"}} {
+		db.Assert(Atom{Name: "parent", Args: []any{String(edge[0]), String(edge[1])}})
+	}
+	x, y, z := Var{Name: "X"}, Var{Name: "Y"}, Var{Name: "Z"}
+	// ancestor(X, Y) :- parent(X, Y).
+	db.Assert(Rule{
+		Atom: Atom{Name: "ancestor", Args: []any{x, y}},
+		Body: []Evaluable{
+			Atom{Name: "parent", Args: []any{x, y}},
+		},
+	})
+	// ancestor(X, Y) :- parent(X, Z), ancestor(Z, Y).
+	db.Assert(Rule{
+		Atom: Atom{Name: "ancestor", Args: []any{x, y}},
+		Body: []Evaluable{
+			Atom{Name: "parent", Args: []any{x, z}},
+			Atom{Name: "ancestor", Args: []any{z, y}},
+		},
+	})
+	if err := db.Materialize("ancestor"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	materialized := func() []string {
+		var facts []string
+		for _, val := range db.views.store.clauses("ancestor") {
+			facts = append(facts, val.(Atom).String())
+		}
+		slices.Sort(facts)
+		return facts
+	}
+	query := Atom{Name: "ancestor", Args: []any{x, y}}
+
+	// ancestor(a, c) and ancestor(a, d) are still derived using parent(a, c)
+	db.Remove(Atom{Name: "parent", Args: []any{String("b"), String("c")}})
+	expected := []string{"ancestor(a, b)", "ancestor(a, c)", "ancestor(a, d)", "ancestor(c, d)"}
+	if result := materialized(); !slices.Equal(result, expected) {
+		t.Errorf("expected: %v, got: %v", expected, result)
+	}
+	if result := queryAll(t, db, query); !slices.Equal(result, expected) {
+		t.Errorf("expected: %v, got: %v", expected, result)
+	}
+
+	db.Remove(Atom{Name: "parent", Args: []any{String("a"), String("c")}})
+	expected = []string{"ancestor(a, b)", "ancestor(c, d)"}
+	if result := materialized(); !slices.Equal(result, expected) {
+		t.Errorf("expected: %v, got: %v", expected, result)
+	}
+
+	db.Assert(Atom{Name: "parent", Args: []any{String("b"), String("c")}})
+	expected = []string{
+		"ancestor(a, b)", "ancestor(a, c)", "ancestor(a, d)",
+		"ancestor(b, c)", "ancestor(b, d)", "ancestor(c, d)",
+	}
+	if result := materialized(); !slices.Equal(result, expected) {
+		t.Errorf("expected: %v, got: %v", expected, result)
+	}
+}
+
+// The materialized relations give the same results as the ones
+// derived from scratch, after random changes.
+func TestMaterializeRandom(t *testing.T) {
+	x, y, z, n := Var{Name: "X"}, Var{Name: "Y"}, Var{Name: "Z"}, Var{Name: "N"}
+	rules := []Rule{
+		{
+			Atom: Atom{Name: "path", Args: []any{x, y}},
+			Body: []Evaluable{Atom{Name: "edge", Args: []any{x, y}}},
+		},
+		{
+			Atom: Atom{Name: "path", Args: []any{x, y}},
+			Body: []Evaluable{Atom{Name: "path", Args: []any{x, z}}, Atom{Name: "path", Args: []any{z, y}}},
+		},
+		{
+			Atom: Atom{Name: "node", Args: []any{x}},
+			Body: []Evaluable{Atom{Name: "edge", Args: []any{x, Wildcard{}}}},
+		},
+		{
+			Atom: Atom{Name: "node", Args: []any{x}},
+			Body: []Evaluable{Atom{Name: "edge", Args: []any{Wildcard{}, x}}},
+		},
+		{
+			Atom: Atom{Name: "unreachable", Args: []any{x, y}},
+			Body: []Evaluable{
+				Atom{Name: "node", Args: []any{x}},
+				Atom{Name: "node", Args: []any{y}},
+				Negation{Atom: Atom{Name: "path", Args: []any{x, y}}},
+			},
+		},
+		{
+			Atom: Atom{Name: "degree", Args: []any{x, n}},
+			Body: []Evaluable{
+				Atom{Name: "node", Args: []any{x}},
+				Aggregate{Func: "count", Result: n, Body: []Evaluable{Atom{Name: "path", Args: []any{x, Wildcard{}}}}},
+			},
+		},
+	}
+	view, plain := NewDatabase(), NewDatabase()
+	view.Strategy, plain.Strategy = BottomUp, BottomUp
+	for _, r := range rules {
+		view.Assert(r)
+		plain.Assert(r)
+	}
+	for _, key := range []Key{"unreachable", "degree"} {
+		if err := view.Materialize(key); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		edge := Atom{Name: "edge", Args: []any{rng.Intn(6), rng.Intn(6)}}
+		if rng.Intn(2) == 0 {
+			view.Assert(edge)
+			plain.Assert(edge)
+		} else {
+			view.Remove(edge)
+			plain.Remove(edge)
+		}
+		for _, q := range []Atom{
+			{Name: "path", Args: []any{x, y}},
+			{Name: "unreachable", Args: []any{x, y}},
+			{Name: "degree", Args: []any{x, n}},
+		} {
+			a, b := queryAll(t, view, q), queryAll(t, plain, q)
+			if !slices.Equal(a, b) {
+				t.Fatalf("step %d %v: %v\nexpected %v\ngot %v", i, edge, q, b, a)
+			}
+		}
+	}
+}
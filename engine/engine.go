@@ -0,0 +1,203 @@
+// Package engine is the API for embedding the Datalog interpreter in Go programs.
+//
+//	e := engine.New()
+//	err := e.Exec(ctx, `
+//		parent(xerces, brooke).
+//		parent(brooke, damocles).
+//		ancestor(X, Y) :- parent(X, Y).
+//		ancestor(X, Y) :- parent(X, Z), ancestor(Z, Y).
+//	`)
+//	rows, err := e.Query(ctx, "ancestor(xerces, X)")
+//	defer rows.Close()
+//	for rows.Next() {
+//		var who, whom string
+//		err := rows.Scan(&who, &whom)
+//		...
+//	}
+//	err = rows.Err()
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/twolodzko/datalogo/datalog"
+	"github.com/twolodzko/datalogo/eval"
+	"github.com/twolodzko/datalogo/parser"
+)
+
+// Engine evaluates the Datalog programs against its database.
+// It is safe for concurrent use: the queries can run concurrently,
+// while Exec waits for all the open Rows to be closed.
+type Engine struct {
+	db *datalog.Database
+	mu sync.RWMutex
+}
+
+func New() *Engine {
+	return NewWithDatabase(datalog.NewDatabase())
+}
+
+// Create the engine using an existing database, e.g. one with a journal.
+func NewWithDatabase(db *datalog.Database) *Engine {
+	return &Engine{db: db}
+}
+
+// Set the order of the query results, the same as the #order directive.
+func (e *Engine) SetOrder(order datalog.Order) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.db.Order = order
+}
+
+// Set the semantics of the query results, the same as the #set and #bag directives.
+func (e *Engine) SetSemantics(semantics datalog.Semantics) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.db.Semantics = semantics
+}
+
+// Set the strategy used for answering the queries, the same as the #strategy directive.
+func (e *Engine) SetStrategy(strategy datalog.Strategy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.db.Strategy = strategy
+}
+
+// Set the maximal number of goroutines evaluating a query, see Database.Workers.
+func (e *Engine) SetWorkers(workers int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.db.Workers = workers
+}
+
+// Evaluate all the facts, rules, and directives in the source.
+// The results of the queries are discarded, but their errors are reported.
+func (e *Engine) Exec(ctx context.Context, src string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	p := parser.NewParser(strings.NewReader(src))
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		expr, err := p.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		out := make(chan datalog.Result)
+		if err := eval.EvalContext(ctx, expr, e.db, out); err != nil {
+			return err
+		}
+		for result := range out {
+			if result.Err != nil && err == nil {
+				err = result.Err
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// Explain how the query with the pattern like "ancestor(xerces, X)"
+// would be evaluated, the same as the #explain directive.
+func (e *Engine) Explain(pattern string) (*datalog.Plan, error) {
+	pattern = strings.TrimSuffix(strings.TrimSpace(pattern), "?")
+	p := parser.NewParser(strings.NewReader("#explain " + pattern))
+	expr, err := p.Next()
+	if err != nil {
+		return nil, err
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.db.Explain(expr.(parser.Explain).Query), nil
+}
+
+// Query the database with the pattern like "ancestor(xerces, X)",
+// the trailing "?" is optional. The query is cancelled when the context
+// is done or when the Rows are closed.
+func (e *Engine) Query(ctx context.Context, pattern string) (*Rows, error) {
+	query, err := parseQuery(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return e.QueryAtom(ctx, query)
+}
+
+// Query the database like Query, but answer the query using the strategy
+// instead of the engine's one, e.g. to evaluate the left-recursive rules
+// bottom-up without switching the whole database.
+func (e *Engine) QueryStrategy(ctx context.Context, pattern string, strategy datalog.Strategy) (*Rows, error) {
+	query, err := parseQuery(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return e.query(ctx, query, func(ctx context.Context, query datalog.Atom, out chan<- datalog.Result) error {
+		return e.db.QueryStrategy(ctx, query, strategy, out)
+	})
+}
+
+func parseQuery(pattern string) (datalog.Atom, error) {
+	pattern = strings.TrimSpace(pattern)
+	if !strings.HasSuffix(pattern, "?") {
+		pattern += "?"
+	}
+	expr, err := parser.NewParser(strings.NewReader(pattern)).Next()
+	if err != nil {
+		return datalog.Atom{}, err
+	}
+	query, ok := expr.(datalog.Query)
+	if !ok {
+		return datalog.Atom{}, fmt.Errorf("%v is not a query", expr)
+	}
+	return query.Query, nil
+}
+
+// Query the database like Query, but using the already parsed atom.
+func (e *Engine) QueryAtom(ctx context.Context, query datalog.Atom) (*Rows, error) {
+	return e.query(ctx, query, e.db.QueryContext)
+}
+
+// Query the database like Query, but with the proofs of the results,
+// the same as the #why directive. The proofs are available from Rows.Proof.
+func (e *Engine) Why(ctx context.Context, pattern string) (*Rows, error) {
+	pattern = strings.TrimSuffix(strings.TrimSpace(pattern), "?")
+	expr, err := parser.NewParser(strings.NewReader("#why " + pattern)).Next()
+	if err != nil {
+		return nil, err
+	}
+	return e.query(ctx, expr.(parser.Why).Query, e.db.Why)
+}
+
+func (e *Engine) query(
+	ctx context.Context,
+	query datalog.Atom,
+	eval func(context.Context, datalog.Atom, chan<- datalog.Result) error,
+) (*Rows, error) {
+	e.mu.RLock()
+	ctx, cancel := context.WithCancel(ctx)
+	out := make(chan datalog.Result)
+	if err := eval(ctx, query, out); err != nil {
+		cancel()
+		e.mu.RUnlock()
+		return nil, err
+	}
+	return &Rows{
+		ctx:    ctx,
+		cancel: cancel,
+		out:    out,
+		unlock: e.mu.RUnlock,
+	}, nil
+}
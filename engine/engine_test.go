@@ -0,0 +1,328 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/twolodzko/datalogo/datalog"
+)
+
+const family = `
+parent(xerces, brooke).
+parent(brooke, damocles).
+age(xerces, 80).
+ancestor(X, Y) :- parent(X, Y).
+ancestor(X, Y) :- parent(X, Z), ancestor(Z, Y).
+`
+
+func TestQueryAndScan(t *testing.T) {
+	ctx := context.Background()
+	e := New()
+	if err := e.Exec(ctx, family); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rows, err := e.Query(ctx, "ancestor(xerces, X)")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer rows.Close()
+
+	var result []string
+	for rows.Next() {
+		var who, whom string
+		if err := rows.Scan(&who, &whom); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result = append(result, who+" "+whom)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	sort.Strings(result)
+
+	expected := []string{"xerces brooke", "xerces damocles"}
+	if !cmp.Equal(result, expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+}
+
+func TestSortedQuery(t *testing.T) {
+	ctx := context.Background()
+	e := New()
+	e.SetOrder(datalog.Sorted)
+	err := e.Exec(ctx, `
+	edge(c, 2).
+	edge(a, 10).
+	edge(b, x).
+	edge(b, 1).
+	twice(X, Y) :- edge(X, Y).
+	twice(X, Y) :- edge(X, Y), Y != x.
+	`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rows, err := e.Query(ctx, "twice(X, Y)")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer rows.Close()
+
+	var result []string
+	for rows.Next() {
+		result = append(result, rows.Atom().String())
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []string{"twice(a, 10)", "twice(b, 1)", "twice(b, x)", "twice(c, 2)"}
+	if !cmp.Equal(result, expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+}
+
+func TestQueryStrategy(t *testing.T) {
+	ctx := context.Background()
+	e := New()
+	err := e.Exec(ctx, `
+	parent(xerces, brooke).
+	parent(brooke, damocles).
+	ancestor(X, Y) :- ancestor(X, Z), parent(Z, Y).
+	ancestor(X, Y) :- parent(X, Y).
+	less(A, B) :- A < B.
+	`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the left-recursive rule needs the bottom-up evaluation
+	rows, err := e.QueryStrategy(ctx, "ancestor(xerces, X)", datalog.BottomUp)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var result []string
+	for rows.Next() {
+		var who, whom string
+		if err := rows.Scan(&who, &whom); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result = append(result, who+" "+whom)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rows.Close()
+	sort.Strings(result)
+	expected := []string{"xerces brooke", "xerces damocles"}
+	if !cmp.Equal(result, expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+
+	// the other queries are still evaluated top-down,
+	// the rule with the unbound variables is not evaluable bottom-up
+	rows, err = e.Query(ctx, "less(1, 2)")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		t.Errorf("expected a result, got error: %v", rows.Err())
+	}
+}
+
+func TestScanTypes(t *testing.T) {
+	ctx := context.Background()
+	e := New()
+	if err := e.Exec(ctx, family); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rows, err := e.Query(ctx, "age(X, Y)?")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		t.Fatalf("expected a result, got error: %v", rows.Err())
+	}
+
+	var (
+		name string
+		age  int64
+		val  any
+	)
+	if err := rows.Scan(&name, &age); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if name != "xerces" || age != 80 {
+		t.Errorf("unexpected values: %v, %v", name, age)
+	}
+	var float float64
+	if err := rows.Scan(&name, &float); err != nil || float != 80 {
+		t.Errorf("expected the integer to be scanned into float64, got: %v, %v", float, err)
+	}
+	if err := rows.Scan(&val, &name); err == nil {
+		t.Error("expected an error when scanning integer into string")
+	}
+	if err := rows.Scan(&name); err == nil {
+		t.Error("expected an error for the wrong number of destinations")
+	}
+}
+
+func TestQueryDeadline(t *testing.T) {
+	e := New()
+	// never terminates in the top-down evaluation
+	if err := e.Exec(context.Background(), "loop(X) :- loop(X)."); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	rows, err := e.Query(ctx, "loop(a)")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for rows.Next() {
+		t.Errorf("unexpected result: %v", rows.Atom())
+	}
+	if !errors.Is(rows.Err(), context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got: %v", rows.Err())
+	}
+	rows.Close()
+
+	checkGoroutines(t, before)
+}
+
+func TestCloseStopsQuery(t *testing.T) {
+	ctx := context.Background()
+	e := New()
+	if err := e.Exec(ctx, family+"loop(X) :- loop(X).\nloop(a)."); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	before := runtime.NumGoroutine()
+
+	rows, err := e.Query(ctx, "loop(X)")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !rows.Next() {
+		t.Fatalf("expected a result, got error: %v", rows.Err())
+	}
+	rows.Close()
+	if rows.Next() {
+		t.Error("expected no results after closing")
+	}
+
+	checkGoroutines(t, before)
+
+	// the engine is not locked after closing the rows
+	if err := e.Exec(ctx, "foo(a)."); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	ctx := context.Background()
+	e := New()
+	err := e.Exec(ctx, `
+	person(alice). person(bob). person(carol).
+	admin(bob).
+	special(X) :- person(X), admin(X), X != carol.
+	`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	plan, err := e.Explain("special(X)?")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := strings.Join([]string{
+		"special(X)  [scan, 0 facts, 1 rules, ~1000.0 matches]",
+		"└── special(X) :- admin(X), X != carol, person(X)",
+		"    ├── admin(X)  [scan, 1 facts, 0 rules, ~1.0 matches]",
+		"    ├── X != carol",
+		"    └── person(X)  [tree(+), 3 facts, 0 rules, ~0.3 matches]",
+	}, "\n")
+	if plan.String() != expected {
+		t.Errorf("expected:\n%v\ngot:\n%v", expected, plan)
+	}
+}
+
+func TestWhy(t *testing.T) {
+	ctx := context.Background()
+	e := New()
+	err := e.Exec(ctx, `
+	parent(a, b). parent(b, c).
+	ancestor(X, Y) :- parent(X, Y).
+	ancestor(X, Y) :- parent(X, Z), ancestor(Z, Y).
+	`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rows, err := e.Why(ctx, "ancestor(a, c)?")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer rows.Close()
+	var proofs []string
+	for rows.Next() {
+		proofs = append(proofs, rows.Proof().String())
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := strings.Join([]string{
+		"ancestor(a, c)  by ancestor(X, Y) :- parent(X, Z), ancestor(Z, Y)  with X = a, Y = c, Z = b",
+		"  parent(a, b)  fact",
+		"  ancestor(b, c)  by ancestor(X, Y) :- parent(X, Y)  with X = b, Y = c",
+		"    parent(b, c)  fact",
+	}, "\n")
+	if len(proofs) != 1 || proofs[0] != expected {
+		t.Errorf("expected:\n%v\ngot:\n%v", expected, proofs)
+	}
+}
+
+func TestExecErrors(t *testing.T) {
+	ctx := context.Background()
+	e := New()
+	if err := e.Exec(ctx, "foo(X) :- !bar(X)."); err == nil {
+		t.Error("expected an error for the unsafe rule")
+	}
+	if err := e.Exec(ctx, "foo(1 / 0)."); err == nil {
+		t.Error("expected an error for division by zero")
+	}
+	if _, err := e.Query(ctx, "foo(a)."); err == nil {
+		t.Error("expected an error for a non-query")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := e.Exec(cancelled, "foo(a)."); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context canceled, got: %v", err)
+	}
+}
+
+// Check if the number of goroutines went back to the initial one,
+// giving them some time to exit.
+func checkGoroutines(t *testing.T, before int) {
+	var after int
+	for range 100 {
+		after = runtime.NumGoroutine()
+		if after <= before {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("goroutines leaked: %d before, %d after", before, after)
+}
@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/twolodzko/datalogo/datalog"
+)
+
+// Rows is an iterator over the results of a query.
+// It needs to be closed when no longer used, otherwise the goroutines
+// evaluating the query would leak.
+type Rows struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	out    chan datalog.Result
+	unlock func()
+	once   sync.Once
+	atom   datalog.Atom
+	proof  *datalog.Proof
+	err    error
+	done   bool
+}
+
+// Advance to the next result, return false when there are no more
+// results or the evaluation failed, see Err.
+func (r *Rows) Next() bool {
+	if r.done {
+		return false
+	}
+	result, ok := <-r.out
+	switch {
+	case !ok:
+		r.err = r.ctx.Err()
+		r.Close()
+		return false
+	case result.Err != nil:
+		r.err = result.Err
+		r.Close()
+		return false
+	case r.ctx.Err() != nil:
+		// the result might have been sent after cancellation
+		r.err = r.ctx.Err()
+		r.Close()
+		return false
+	}
+	r.atom = result.Atom
+	r.proof = result.Proof
+	return true
+}
+
+// The current result.
+func (r *Rows) Atom() datalog.Atom {
+	return r.atom
+}
+
+// Proof of the current result, nil unless the Rows were returned by Engine.Why.
+// It can be printed as an indented tree, or encoded as JSON.
+func (r *Rows) Proof() *datalog.Proof {
+	return r.proof
+}
+
+// Copy the arguments of the current result to the values pointed at by dest.
+// The supported destination types are *int, *int64, *float64, *string,
+// *datalog.String, and *any. Integers can be scanned into *float64.
+func (r *Rows) Scan(dest ...any) error {
+	if len(dest) != len(r.atom.Args) {
+		return fmt.Errorf("expected %d destinations, got %d", len(r.atom.Args), len(dest))
+	}
+	for i, arg := range r.atom.Args {
+		if err := scan(arg, dest[i]); err != nil {
+			return fmt.Errorf("argument %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func scan(arg, dest any) error {
+	switch dest := dest.(type) {
+	case *any:
+		*dest = arg
+		return nil
+	case *int:
+		if val, ok := arg.(int); ok {
+			*dest = val
+			return nil
+		}
+	case *int64:
+		if val, ok := arg.(int); ok {
+			*dest = int64(val)
+			return nil
+		}
+	case *float64:
+		switch val := arg.(type) {
+		case datalog.Float:
+			*dest = float64(val)
+			return nil
+		case int:
+			*dest = float64(val)
+			return nil
+		}
+	case *string:
+		if val, ok := arg.(datalog.String); ok {
+			*dest = string(val)
+			return nil
+		}
+	case *datalog.String:
+		if val, ok := arg.(datalog.String); ok {
+			*dest = val
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported destination type %T", dest)
+	}
+	return fmt.Errorf("cannot scan %v of type %T into %T", arg, arg, dest)
+}
+
+// The error that stopped the iteration, if any. Cancelling
+// the context is reported as its error.
+func (r *Rows) Err() error {
+	return r.err
+}
+
+// Stop the query, wait for its goroutines to finish, and release the resources.
+// It is safe to call Close multiple times.
+func (r *Rows) Close() error {
+	r.once.Do(func() {
+		r.done = true
+		r.cancel()
+		// the channel is closed after all the goroutines finished
+		for range r.out {
+		}
+		r.unlock()
+	})
+	return nil
+}
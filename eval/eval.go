@@ -2,39 +2,63 @@ package eval
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"os"
-	"strings"
 
 	//lint:ignore ST1001 this is an internal dependency
 	. "github.com/twolodzko/datalogo/datalog"
 	"github.com/twolodzko/datalogo/parser"
 )
 
-// Evaluate the expression, if it is a Query type, send the
-// results to the out channel, and close the channel afterwards.
-func Eval(expr any, db Database, out chan Atom) error {
-	if _, ok := expr.(Query); !ok {
+// Evaluate the expression, if it is a Query type or the #why directive,
+// send the results to the out channel, for the #explain directive send
+// the plan, and close the channel afterwards.
+func Eval(expr any, db *Database, out chan Result) error {
+	return EvalContext(context.Background(), expr, db, out)
+}
+
+// Evaluate the expression like Eval, but stop when the context is cancelled.
+func EvalContext(ctx context.Context, expr any, db *Database, out chan Result) error {
+	switch expr.(type) {
+	case Query, parser.Why, parser.Explain:
+	default:
 		close(out)
 	}
 	switch expr := expr.(type) {
 	case Assertion:
 		if val, ok := expr.Fact.(HasKey); ok {
-			db.Assert(val)
+			return db.Assert(val)
 		} else {
 			return fmt.Errorf("%v cannot be stored in database", expr.Fact)
 		}
 	case Retraction:
-		db.Remove(expr.Fact)
+		return db.Remove(expr.Fact)
 	case Query:
-		db.Query(expr.Query, out)
+		return db.QueryContext(ctx, expr.Query, out)
+	case Strategy:
+		db.Strategy = expr
+	case Order:
+		db.Order = expr
+	case Semantics:
+		db.Semantics = expr
+	case parser.Table:
+		db.Table(Key(expr.Name), expr.Arity)
+	case parser.Index:
+		db.Index(Key(expr.Name), expr.Arity, expr.Positions)
+	case parser.Materialize:
+		return db.Materialize(Key(expr.Name))
 	case parser.Input:
-		reader, err := NewInputReader(expr)
+		reader, err := NewFactReader(expr)
 		if err != nil {
 			return err
 		}
+		defer reader.Close()
 		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			atom, err := reader.Next()
 			if err == io.EOF {
 				break
@@ -42,53 +66,141 @@ func Eval(expr any, db Database, out chan Atom) error {
 			if err != nil {
 				return err
 			}
-			db.Assert(atom)
+			if err := db.Assert(atom); err != nil {
+				return err
+			}
+		}
+	case parser.Output:
+		return WriteOutput(ctx, expr, db)
+	case parser.Why:
+		return db.Why(ctx, expr.Query, out)
+	case parser.Explain:
+		plan := db.Explain(expr.Query)
+		go func() {
+			defer close(out)
+			select {
+			case out <- Result{Plan: plan}:
+			case <-ctx.Done():
+			}
+		}()
+	case parser.Save:
+		file, err := os.Create(expr.Path)
+		if err != nil {
+			return err
 		}
+		defer file.Close()
+		writer := bufio.NewWriter(file)
+		if _, err := db.WriteTo(writer); err != nil {
+			return err
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		return file.Close()
+	case parser.Load:
+		file, err := os.Open(expr.Path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = db.ReadFrom(file)
+		return err
 	default:
 		return fmt.Errorf("invalid expression type: %t", expr)
 	}
 	return nil
 }
 
+// FactReader reads the facts from the source described by
+// the #input directive.
+type FactReader interface {
+	// Read the next fact, return io.EOF when there are no more facts.
+	Next() (Atom, error)
+	Close() error
+}
+
+func NewFactReader(inp parser.Input) (FactReader, error) {
+	switch inp.Format {
+	case "json", "jsonl":
+		return NewJSONReader(inp)
+	default:
+		return NewInputReader(inp)
+	}
+}
+
+// Open the file or the standard input, the closer is nil for the standard input.
+func openSource(source string) (io.Reader, io.Closer, error) {
+	if source == "stdin" {
+		return os.Stdin, nil, nil
+	}
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, file, nil
+}
+
+// InputReader reads the facts from the delimited file
+// described by the #input directive.
 type InputReader struct {
 	parser.Input
-	row int
-	parser.Parser
+	reader  *RecordReader
+	closer  io.Closer
+	started bool
 }
 
-func NewInputReader(inp parser.Input) (InputReader, error) {
-	var reader *bufio.Reader
-	switch inp.Source {
-	case "stdin":
-		reader = bufio.NewReader(os.Stdin)
-	default:
-		file, err := os.Open(inp.Source)
-		if err != nil {
-			return InputReader{}, err
-		}
-		reader = bufio.NewReader(file)
+func NewInputReader(inp parser.Input) (*InputReader, error) {
+	reader, closer, err := openSource(inp.Source)
+	if err != nil {
+		return nil, err
 	}
-	return InputReader{
-		Input: inp,
-		Parser: parser.Parser{
-			Reader: reader,
-		},
+	return &InputReader{
+		Input:  inp,
+		reader: NewRecordReader(reader, inp.Separator, inp.Quote),
+		closer: closer,
 	}, nil
 }
 
-func (r InputReader) Next() (Atom, error) {
-	for r.row < r.Skip {
-		if _, _, err := r.ReadLine(); err != nil {
+// Close the source file, standard input is left open.
+func (r *InputReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+func (r *InputReader) Next() (Atom, error) {
+	if !r.started {
+		r.started = true
+		if err := r.readHeader(); err != nil {
 			return Atom{}, err
 		}
-		r.row++
 	}
-	line, err := r.ReadString('\n')
+	fields, quoted, err := r.reader.Read()
 	if err != nil {
 		return Atom{}, err
 	}
-	if strings.TrimSpace(line) == "" {
-		return Atom{}, io.EOF
+	atom, err := r.ParseRecord(fields, quoted)
+	if err != nil {
+		return Atom{}, fmt.Errorf("line %d: %w", r.reader.Line(), err)
+	}
+	return atom, nil
+}
+
+// Skip the rows and read the header, if there is one.
+func (r *InputReader) readHeader() error {
+	if err := r.reader.SkipLines(r.Skip); err != nil {
+		return err
+	}
+	if !r.Header {
+		return nil
+	}
+	header, _, err := r.reader.Read()
+	if err != nil {
+		return err
+	}
+	if len(r.ColumnNames) > 0 {
+		r.Columns, err = r.ResolveColumns(header)
 	}
-	return r.ParseLine(line)
+	return err
 }
@@ -0,0 +1,29 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/twolodzko/datalogo/datalog"
+	"github.com/twolodzko/datalogo/parser"
+)
+
+func TestEvalExplain(t *testing.T) {
+	db := datalog.NewDatabase()
+	db.Assert(datalog.Atom{Name: "edge", Args: []any{datalog.String("a"), datalog.String("b")}})
+	query := datalog.Atom{Name: "edge", Args: []any{datalog.String("a"), datalog.Var{Name: "X"}}}
+
+	out := make(chan datalog.Result)
+	if err := Eval(parser.Explain{Query: query}, db, out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var results []datalog.Result
+	for result := range out {
+		results = append(results, result)
+	}
+	if len(results) != 1 || results[0].Plan == nil {
+		t.Fatalf("expected the plan, got: %v", results)
+	}
+	if results[0].Plan.Literal.(datalog.Atom).Name != "edge" {
+		t.Errorf("unexpected plan: %v", results[0].Plan)
+	}
+}
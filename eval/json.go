@@ -0,0 +1,193 @@
+package eval
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	//lint:ignore ST1001 this is an internal dependency
+	. "github.com/twolodzko/datalogo/datalog"
+	"github.com/twolodzko/datalogo/parser"
+)
+
+// JSONReader reads the facts from JSON objects, either one object
+// per line (JSON Lines), or from a top-level array of objects.
+// Each object becomes an atom with the values of the selected fields
+// as the arguments.
+type JSONReader struct {
+	parser.Input
+	closer io.Closer
+	// for JSON Lines
+	scanner *bufio.Scanner
+	// for the JSON array
+	decoder *json.Decoder
+	started bool
+	// the number of the line or of the array element
+	count int
+}
+
+func NewJSONReader(inp parser.Input) (*JSONReader, error) {
+	reader, closer, err := openSource(inp.Source)
+	if err != nil {
+		return nil, err
+	}
+	r := &JSONReader{
+		Input:  inp,
+		closer: closer,
+	}
+	if inp.Format == "jsonl" {
+		r.scanner = bufio.NewScanner(reader)
+		r.scanner.Buffer(nil, 1<<30)
+	} else {
+		r.decoder = json.NewDecoder(reader)
+		r.decoder.UseNumber()
+	}
+	return r, nil
+}
+
+func (r *JSONReader) Next() (Atom, error) {
+	for {
+		obj, err := r.nextObject()
+		if err != nil {
+			return Atom{}, err
+		}
+		atom, ok, err := r.toAtom(obj)
+		if err != nil {
+			if r.scanner != nil {
+				return Atom{}, fmt.Errorf("line %d: %w", r.count, err)
+			}
+			return Atom{}, fmt.Errorf("element %d: %w", r.count, err)
+		}
+		if ok {
+			return atom, nil
+		}
+	}
+}
+
+func (r *JSONReader) nextObject() (any, error) {
+	var obj any
+	if r.scanner != nil {
+		for {
+			if !r.scanner.Scan() {
+				if err := r.scanner.Err(); err != nil {
+					return nil, err
+				}
+				return nil, io.EOF
+			}
+			r.count++
+			line := bytes.TrimSpace(r.scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			decoder := json.NewDecoder(bytes.NewReader(line))
+			decoder.UseNumber()
+			if err := decoder.Decode(&obj); err != nil {
+				return nil, fmt.Errorf("line %d: %w", r.count, err)
+			}
+			return obj, nil
+		}
+	}
+
+	if !r.started {
+		r.started = true
+		token, err := r.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if token != json.Delim('[') {
+			return nil, fmt.Errorf("expected an array of objects, got: %v", token)
+		}
+	}
+	if !r.decoder.More() {
+		// the closing bracket
+		if _, err := r.decoder.Token(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	r.count++
+	if err := r.decoder.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("element %d: %w", r.count, err)
+	}
+	return obj, nil
+}
+
+// Create the atom from the selected fields, return false if the object should be skipped.
+func (r *JSONReader) toAtom(obj any) (Atom, bool, error) {
+	atom := Atom{Name: r.Name}
+	for _, path := range r.Fields {
+		val, ok := lookup(obj, path)
+		if !ok {
+			switch r.Missing {
+			case "skip":
+				return Atom{}, false, nil
+			case "wildcard":
+				atom.Args = append(atom.Args, Wildcard{})
+				continue
+			default:
+				return Atom{}, false, fmt.Errorf("missing field: %s", path)
+			}
+		}
+		arg, err := fromJSON(val)
+		if err != nil {
+			return Atom{}, false, fmt.Errorf("field %s: %w", path, err)
+		}
+		atom.Args = append(atom.Args, arg)
+	}
+	return atom, true, nil
+}
+
+func (r *JSONReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// Find the value under the dot-separated path like "user.id" or "tags.0",
+// null values are treated as missing.
+func lookup(obj any, path string) (any, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch val := obj.(type) {
+		case map[string]any:
+			next, ok := val[key]
+			if !ok {
+				return nil, false
+			}
+			obj = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(val) {
+				return nil, false
+			}
+			obj = val[i]
+		default:
+			return nil, false
+		}
+	}
+	return obj, obj != nil
+}
+
+func fromJSON(val any) (any, error) {
+	switch val := val.(type) {
+	case string:
+		return String(val), nil
+	case json.Number:
+		if i, err := strconv.Atoi(val.String()); err == nil {
+			return i, nil
+		}
+		f, err := val.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("%v is not a number", val)
+		}
+		return Float(f), nil
+	case bool:
+		return String(strconv.FormatBool(val)), nil
+	default:
+		return nil, fmt.Errorf("%v cannot be converted to a constant", val)
+	}
+}
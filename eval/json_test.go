@@ -0,0 +1,134 @@
+package eval
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	. "github.com/twolodzko/datalogo/datalog"
+	"github.com/twolodzko/datalogo/parser"
+)
+
+func TestJSONReader(t *testing.T) {
+	var testCases = []struct {
+		format, data, missing string
+		expected              []Atom
+	}{
+		{
+			"jsonl",
+			`{"user": {"id": 1}, "action": "login", "ts": 100}
+
+{"user": {"id": 2}, "action": "logout", "ts": 200, "extra": [1.5]}
+`,
+			"error",
+			[]Atom{
+				{Name: "event", Args: []any{1, String("login"), 100}},
+				{Name: "event", Args: []any{2, String("logout"), 200}},
+			},
+		},
+		{
+			"json",
+			`[
+				{"user": {"id": 1}, "action": "login", "ts": 100},
+				{"user": {"id": null}, "action": "login", "ts": 150},
+				{"action": "logout", "ts": 200}
+			]`,
+			"skip",
+			[]Atom{
+				{Name: "event", Args: []any{1, String("login"), 100}},
+			},
+		},
+		{
+			"jsonl",
+			`{"user": {"id": 1}, "action": "login", "ts": 1.5}
+{"user": {"id": 2}, "action": "login", "ts": 2.0}`,
+			"error",
+			[]Atom{
+				{Name: "event", Args: []any{1, String("login"), Float(1.5)}},
+				{Name: "event", Args: []any{2, String("login"), Float(2)}},
+			},
+		},
+		{
+			"jsonl",
+			`{"user": {"id": 1}, "action": "login"}`,
+			"wildcard",
+			[]Atom{
+				{Name: "event", Args: []any{1, String("login"), Wildcard{}}},
+			},
+		},
+	}
+
+	for _, tt := range testCases {
+		path := filepath.Join(t.TempDir(), "events")
+		if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		reader, err := NewJSONReader(parser.Input{
+			Name:    "event",
+			Source:  path,
+			Format:  tt.format,
+			Fields:  []string{"user.id", "action", "ts"},
+			Missing: tt.missing,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		var result []Atom
+		for {
+			atom, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("for %s unexpected error: %s", tt.data, err)
+			}
+			result = append(result, atom)
+		}
+		reader.Close()
+
+		if !cmp.Equal(result, tt.expected) {
+			t.Errorf("for %s expected %v, got %v", tt.data, tt.expected, result)
+		}
+	}
+}
+
+func TestJSONReaderErrors(t *testing.T) {
+	var testCases = []struct {
+		format, data string
+	}{
+		{"jsonl", `{"id": 1}`},
+		{"jsonl", `{"id": 1, "name": "a"}` + "\n" + `{"id": 1e400, "name": "b"}`},
+		{"jsonl", `{"id": 1, "name": {"first": "a"}}`},
+		{"json", `{"id": 1, "name": "a"}`},
+	}
+
+	for _, tt := range testCases {
+		path := filepath.Join(t.TempDir(), "data")
+		if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		reader, err := NewJSONReader(parser.Input{
+			Name:    "foo",
+			Source:  path,
+			Format:  tt.format,
+			Fields:  []string{"id", "name"},
+			Missing: "error",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		for {
+			_, err = reader.Next()
+			if err != nil {
+				break
+			}
+		}
+		reader.Close()
+		if err == io.EOF {
+			t.Errorf("for %s expected an error", tt.data)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package eval
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	//lint:ignore ST1001 this is an internal dependency
+	. "github.com/twolodzko/datalogo/datalog"
+	"github.com/twolodzko/datalogo/parser"
+)
+
+// Write the distinct tuples matching the output's pattern
+// as delimited rows, sorted by the values of the columns.
+func WriteOutput(ctx context.Context, out parser.Output, db *Database) error {
+	var queries []Atom
+	if len(out.Args) > 0 {
+		queries = append(queries, Atom{Name: out.Name, Args: out.Args})
+	} else {
+		// all the tuples of the relation, for each of its arities
+		for _, n := range db.Arities(Key(out.Name)) {
+			var args []any
+			for i := range n {
+				args = append(args, Var{Name: fmt.Sprintf("_%d", i)})
+			}
+			queries = append(queries, Atom{Name: out.Name, Args: args})
+		}
+	}
+
+	var rows [][]any
+	for _, query := range queries {
+		ch := make(chan Result)
+		if err := db.QueryContext(ctx, query, ch); err != nil {
+			return err
+		}
+		var err error
+		for result := range ch {
+			if result.Err != nil {
+				if err == nil {
+					err = result.Err
+				}
+				continue
+			}
+			rows = append(rows, result.Args)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	slices.SortFunc(rows, CompareArgs)
+	rows = slices.CompactFunc(rows, func(a, b []any) bool {
+		return CompareArgs(a, b) == 0
+	})
+
+	if out.Dest == "stdout" {
+		return writeRows(os.Stdout, out.Separator, rows)
+	}
+	file, err := os.Create(out.Dest)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := writeRows(file, out.Separator, rows); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func writeRows(w io.Writer, separator rune, rows [][]any) error {
+	buf := bufio.NewWriter(w)
+	for _, row := range rows {
+		for i, val := range row {
+			if i > 0 {
+				buf.WriteRune(separator)
+			}
+			buf.WriteString(formatField(val, separator))
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Flush()
+}
+
+// Format the value as a field of the delimited file. The fields are quoted
+// like in RFC 4180 if needed, and the Strings that would be read back
+// as numbers, or as the empty lines, are always quoted.
+func formatField(val any, separator rune) string {
+	var (
+		field string
+		quote bool
+	)
+	switch val := val.(type) {
+	case int:
+		return strconv.Itoa(val)
+	case String:
+		field = string(val)
+		_, quote = ParseNumber(field)
+		quote = quote || field == ""
+	default:
+		field = fmt.Sprintf("%v", val)
+	}
+	if quote || needsQuotes(field, separator) {
+		return `"` + strings.ReplaceAll(field, `"`, `""`) + `"`
+	}
+	return field
+}
+
+// Check if the field contains the separator, quotes, or newlines,
+// or starts with a space, the same as encoding/csv does.
+func needsQuotes(field string, separator rune) bool {
+	if strings.ContainsRune(field, separator) || strings.ContainsAny(field, "\"\r\n") {
+		return true
+	}
+	return strings.HasPrefix(field, " ") || strings.HasPrefix(field, "\t")
+}
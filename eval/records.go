@@ -0,0 +1,156 @@
+package eval
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// RecordReader reads the delimited records as described in RFC 4180,
+// but with a configurable separator and quote characters.
+// The quoted fields can contain the separators, newlines, and the quotes
+// escaped by doubling them. The lines can end with LF or CRLF.
+// Empty lines are skipped.
+type RecordReader struct {
+	reader    *bufio.Reader
+	separator rune
+	// zero disables quoting
+	quote rune
+	line  int
+}
+
+func NewRecordReader(r io.Reader, separator, quote rune) *RecordReader {
+	return &RecordReader{
+		reader:    bufio.NewReader(r),
+		separator: separator,
+		quote:     quote,
+	}
+}
+
+// Line number of the last read line.
+func (r *RecordReader) Line() int {
+	return r.line
+}
+
+// Skip the n lines, ignoring their content.
+func (r *RecordReader) SkipLines(n int) error {
+	for range n {
+		if _, err := r.reader.ReadString('\n'); err != nil {
+			return err
+		}
+		r.line++
+	}
+	return nil
+}
+
+// Read the next record, return its fields, and for each
+// field, the information if the field was quoted.
+func (r *RecordReader) Read() ([]string, []bool, error) {
+	for {
+		fields, quoted, err := r.readRecord()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(fields) == 1 && !quoted[0] && fields[0] == "" {
+			// empty line
+			continue
+		}
+		return fields, quoted, nil
+	}
+}
+
+func (r *RecordReader) readRecord() ([]string, []bool, error) {
+	var (
+		fields []string
+		quoted []bool
+		field  strings.Builder
+		// the field started with a quote
+		inQuotes bool
+		// the quoted field was closed
+		closed bool
+		// any character of the record was read
+		started bool
+	)
+	r.line++
+	start := r.line
+
+	endField := func() {
+		fields = append(fields, field.String())
+		quoted = append(quoted, inQuotes)
+		field.Reset()
+		inQuotes, closed = false, false
+	}
+
+	for {
+		c, _, err := r.reader.ReadRune()
+		if err == io.EOF {
+			switch {
+			case inQuotes && !closed:
+				return nil, nil, fmt.Errorf("line %d: unterminated quoted field", start)
+			case !started:
+				return nil, nil, io.EOF
+			default:
+				endField()
+				return fields, quoted, nil
+			}
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		started = true
+
+		if inQuotes && !closed {
+			switch c {
+			case r.quote:
+				next, _, err := r.reader.ReadRune()
+				switch {
+				case err == io.EOF:
+					closed = true
+				case err != nil:
+					return nil, nil, err
+				case next == r.quote:
+					// escaped quote
+					field.WriteRune(c)
+				default:
+					closed = true
+					if err := r.reader.UnreadRune(); err != nil {
+						return nil, nil, err
+					}
+				}
+			case '\n':
+				r.line++
+				field.WriteRune(c)
+			default:
+				field.WriteRune(c)
+			}
+			continue
+		}
+
+		switch {
+		case c == r.separator:
+			endField()
+		case c == '\n':
+			endField()
+			return fields, quoted, nil
+		case c == '\r':
+			next, err := r.reader.Peek(1)
+			if err == nil && next[0] == '\n' {
+				// CRLF
+				continue
+			}
+			field.WriteRune(c)
+		case closed:
+			if !unicode.IsSpace(c) {
+				return nil, nil, fmt.Errorf("line %d: unexpected %q after the quoted field", r.line, c)
+			}
+		case c == r.quote && r.quote != 0 && strings.TrimSpace(field.String()) == "":
+			// the whitespace before the quote is ignored
+			field.Reset()
+			inQuotes = true
+		default:
+			field.WriteRune(c)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package eval
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRecordReader(t *testing.T) {
+	var testCases = []struct {
+		input     string
+		separator rune
+		quote     rune
+		fields    [][]string
+		quoted    [][]bool
+	}{
+		{
+			"a,b,c\n1,2,3\n",
+			',', '"',
+			[][]string{{"a", "b", "c"}, {"1", "2", "3"}},
+			[][]bool{{false, false, false}, {false, false, false}},
+		},
+		{
+			"a,\"b, c\",\"say \"\"hi\"\"\"\r\n\n\"multi\nline\",x",
+			',', '"',
+			[][]string{{"a", "b, c", `say "hi"`}, {"multi\nline", "x"}},
+			[][]bool{{false, true, true}, {true, false}},
+		},
+		{
+			"a\t 'b\tc' \t,\n",
+			'\t', '\'',
+			[][]string{{"a", "b\tc", ","}},
+			[][]bool{{false, true, false}},
+		},
+		{
+			"\"a\",\"\"\n",
+			',', 0,
+			[][]string{{`"a"`, `""`}},
+			[][]bool{{false, false}},
+		},
+	}
+
+	for _, tt := range testCases {
+		reader := NewRecordReader(strings.NewReader(tt.input), tt.separator, tt.quote)
+		var (
+			fields [][]string
+			quoted [][]bool
+		)
+		for {
+			f, q, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("for %q unexpected error: %s", tt.input, err)
+			}
+			fields = append(fields, f)
+			quoted = append(quoted, q)
+		}
+		if !cmp.Equal(fields, tt.fields) {
+			t.Errorf("for %q expected %q, got %q", tt.input, tt.fields, fields)
+		}
+		if !cmp.Equal(quoted, tt.quoted) {
+			t.Errorf("for %q expected %v, got %v", tt.input, tt.quoted, quoted)
+		}
+	}
+}
+
+func TestRecordReaderErrors(t *testing.T) {
+	for _, input := range []string{
+		"a,\"b\nc",
+		"a,\"b\"c\n",
+	} {
+		reader := NewRecordReader(strings.NewReader(input), ',', '"')
+		if _, _, err := reader.Read(); err == nil || err == io.EOF {
+			t.Errorf("for %q expected an error, got %v", input, err)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package main_test
 import (
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
@@ -30,18 +32,18 @@ func TestUnify(t *testing.T) {
 		// variables
 		{Var{Name: "X"}, Var{Name: "Y"}, Vars{}, true},
 		{Var{Name: "X"}, Var{Name: "Y"}, newVars(
-			Mapping{Var{Name: "X"}, String("ok")},
+			Mapping{Key: Var{Name: "X"}, Val: String("ok")},
 		), true},
 		{Var{Name: "X"}, Var{Name: "Y"}, newVars(
-			Mapping{Var{Name: "Y"}, String("ok")},
+			Mapping{Key: Var{Name: "Y"}, Val: String("ok")},
 		), true},
 		{Var{Name: "X"}, Var{Name: "Y"}, newVars(
-			Mapping{Var{Name: "X"}, String("ok")},
-			Mapping{Var{Name: "Y"}, String("ok")},
+			Mapping{Key: Var{Name: "X"}, Val: String("ok")},
+			Mapping{Key: Var{Name: "Y"}, Val: String("ok")},
 		), true},
 		{Var{Name: "X"}, Var{Name: "Y"}, newVars(
-			Mapping{Var{Name: "X"}, String("wrong")},
-			Mapping{Var{Name: "Y"}, String("invalid")},
+			Mapping{Key: Var{Name: "X"}, Val: String("wrong")},
+			Mapping{Key: Var{Name: "Y"}, Val: String("invalid")},
 		), false},
 	}
 
@@ -58,9 +60,9 @@ func TestUnify(t *testing.T) {
 
 func TestUnifyComplex(t *testing.T) {
 	vars := newVars(
-		Mapping{Var{Name: "X"}, String("ok")},
-		Mapping{Var{Name: "Y"}, Var{Name: "X"}},
-		Mapping{Var{Name: "Z"}, Var{Name: "Y"}},
+		Mapping{Key: Var{Name: "X"}, Val: String("ok")},
+		Mapping{Key: Var{Name: "Y"}, Val: Var{Name: "X"}},
+		Mapping{Key: Var{Name: "Z"}, Val: Var{Name: "Y"}},
 	)
 
 	// unify with existing variables
@@ -87,9 +89,9 @@ func TestUnifyComplex(t *testing.T) {
 
 func TestUnifyPropagates(t *testing.T) {
 	vars := newVars(
-		Mapping{Var{Name: "B"}, Var{Name: "A"}},
-		Mapping{Var{Name: "C"}, Var{Name: "B"}},
-		Mapping{Var{Name: "D"}, Var{Name: "A"}},
+		Mapping{Key: Var{Name: "B"}, Val: Var{Name: "A"}},
+		Mapping{Key: Var{Name: "C"}, Val: Var{Name: "B"}},
+		Mapping{Key: Var{Name: "D"}, Val: Var{Name: "A"}},
 	)
 
 	if !vars.Unify(Var{Name: "B"}, String("ok")) {
@@ -497,9 +499,97 @@ func TestIntegration(t *testing.T) {
 				},
 			},
 		},
+		// negation
+		{
+			`
+			edge(a, b).
+			edge(b, c).
+			edge(c, d).
+			blocked(c).
+			reachable(X, Y) :- edge(X, Y), !blocked(Y).
+			reachable(X, Y) :- edge(X, Z), !blocked(Z), reachable(Z, Y).
+			reachable(a, X)?
+			`,
+			[]Atom{
+				{
+					Name: "reachable",
+					Args: []any{
+						String("a"),
+						String("b"),
+					},
+				},
+			},
+		},
+		// the variables bound before the aggregate are the grouping keys
+		{
+			`
+			e(a, b).
+			e(b, c).
+			e(a, c).
+			q(N) :- X = a, N = count : { e(X, _) }.
+			r(N) :- cat("a", "", X), N = count : { e(X, _) }.
+			s(N) :- N = count : { e(X, _) }, X = a.
+			q(N)?
+			r(N)?
+			s(N)?
+			`,
+			[]Atom{
+				{Name: "q", Args: []any{2}},
+				{Name: "r", Args: []any{2}},
+				{Name: "s", Args: []any{3}},
+			},
+		},
+		// aggregates
+		{
+			`
+			edge(a, b).
+			edge(a, c).
+			edge(b, c).
+			cost(a, 3).
+			cost(b, 4).
+			cost(c, 5).
+			degree(X, N) :- cost(X, _), N = count : { edge(X, _) }.
+			total(S) :- S = sum W : { cost(_, W) }.
+			cheapest(X) :- cost(X, C), C = min W : { cost(_, W) }.
+			busiest(X) :- cost(X, _), N = count : { edge(X, _) }, M = max K : { degree(_, K) }, N = M.
+			degree(X, N)?
+			total(S)?
+			cheapest(X)?
+			busiest(X)?
+			`,
+			[]Atom{
+				{Name: "busiest", Args: []any{String("a")}},
+				{Name: "cheapest", Args: []any{String("a")}},
+				{Name: "degree", Args: []any{String("a"), 2}},
+				{Name: "degree", Args: []any{String("b"), 1}},
+				{Name: "degree", Args: []any{String("c"), 0}},
+				{Name: "total", Args: []any{12}},
+			},
+		},
+		// arithmetic
+		{
+			`
+			num(1).
+			num(2).
+			num(3).
+			succ(X, X + 1) :- num(X).
+			double(X, Y) :- num(X), Y = 2 * X.
+			sum(X, Y, Z) :- num(X), num(Y), X < Y, Z = X + Y, Z > 4.
+			succ(X, Y)?
+			double(2, Y)?
+			sum(X, Y, Z)?
+			`,
+			[]Atom{
+				{Name: "double", Args: []any{2, 4}},
+				{Name: "succ", Args: []any{1, 2}},
+				{Name: "succ", Args: []any{2, 3}},
+				{Name: "succ", Args: []any{3, 4}},
+				{Name: "sum", Args: []any{2, 3, 5}},
+			},
+		},
 	}
 	for _, tt := range testCases {
-		db := make(Database)
+		db := NewDatabase()
 		result, err := evalString(tt.input, db)
 
 		sort.Slice(result, func(i, j int) bool {
@@ -515,19 +605,1031 @@ func TestIntegration(t *testing.T) {
 	}
 }
 
-func evalAndCollect(query any, db Database) ([]Atom, error) {
-	ch := make(chan Atom)
+func TestIntegrationBottomUp(t *testing.T) {
+	var testCases = []struct {
+		input    string
+		expected []Atom
+	}{
+		{
+			`
+			parent(xerces, brooke).
+			parent(brooke, damocles).
+			ancestor(X, Y) :- parent(X, Y).
+			ancestor(X, Y) :- ancestor(X, Z), parent(Z, Y).
+			ancestor(xerces, X)?
+			`,
+			[]Atom{
+				{
+					Name: "ancestor",
+					Args: []any{
+						String("xerces"),
+						String("brooke"),
+					},
+				},
+				{
+					Name: "ancestor",
+					Args: []any{
+						String("xerces"),
+						String("damocles"),
+					},
+				},
+			},
+		},
+		{
+			`
+			same(Z, Z).
+			foo(A, B) :- same(A, B), bar(A, x).
+			bar(a, _).
+			foo(X, Y)?
+			`,
+			[]Atom{
+				{
+					Name: "foo",
+					Args: []any{
+						String("a"),
+						String("a"),
+					},
+				},
+			},
+		},
+		{
+			`
+			foo(a).
+			foo(b).
+			foo(c).
+			bar(X) :- X != b, foo(X).
+			bar(X)?
+			`,
+			[]Atom{
+				{
+					Name: "bar",
+					Args: []any{
+						String("a"),
+					},
+				},
+				{
+					Name: "bar",
+					Args: []any{
+						String("c"),
+					},
+				},
+			},
+		},
+		// negation
+		{
+			`
+			edge(a, b).
+			edge(b, c).
+			edge(c, d).
+			blocked(c).
+			reachable(X, Y) :- edge(X, Y), !blocked(Y).
+			reachable(X, Y) :- reachable(X, Z), edge(Z, Y), not blocked(Y).
+			reachable(a, X)?
+			`,
+			[]Atom{
+				{
+					Name: "reachable",
+					Args: []any{
+						String("a"),
+						String("b"),
+					},
+				},
+			},
+		},
+		// the variables bound before the aggregate are the grouping keys
+		{
+			`
+			e(a, b).
+			e(b, c).
+			e(a, c).
+			q(N) :- X = a, N = count : { e(X, _) }.
+			r(N) :- cat("a", "", X), N = count : { e(X, _) }.
+			s(N) :- N = count : { e(X, _) }, X = a.
+			q(N)?
+			r(N)?
+			s(N)?
+			`,
+			[]Atom{
+				{Name: "q", Args: []any{2}},
+				{Name: "r", Args: []any{2}},
+				{Name: "s", Args: []any{3}},
+			},
+		},
+		// aggregates
+		{
+			`
+			edge(a, b).
+			edge(a, c).
+			edge(b, c).
+			cost(a, 3).
+			cost(b, 4).
+			cost(c, 5).
+			degree(X, N) :- cost(X, _), N = count : { edge(X, _) }.
+			total(S) :- S = sum W : { cost(_, W) }.
+			cheapest(X) :- cost(X, C), C = min W : { cost(_, W) }.
+			busiest(X) :- cost(X, _), N = count : { edge(X, _) }, M = max K : { degree(_, K) }, N = M.
+			degree(X, N)?
+			total(S)?
+			cheapest(X)?
+			busiest(X)?
+			`,
+			[]Atom{
+				{Name: "busiest", Args: []any{String("a")}},
+				{Name: "cheapest", Args: []any{String("a")}},
+				{Name: "degree", Args: []any{String("a"), 2}},
+				{Name: "degree", Args: []any{String("b"), 1}},
+				{Name: "degree", Args: []any{String("c"), 0}},
+				{Name: "total", Args: []any{12}},
+			},
+		},
+		// arithmetic
+		{
+			`
+			num(1).
+			num(2).
+			num(3).
+			succ(X, X + 1) :- num(X).
+			double(X, Y) :- num(X), Y = 2 * X.
+			sum(X, Y, Z) :- num(X), num(Y), X < Y, Z = X + Y, Z > 4.
+			succ(X, Y)?
+			double(2, Y)?
+			sum(X, Y, Z)?
+			`,
+			[]Atom{
+				{Name: "double", Args: []any{2, 4}},
+				{Name: "succ", Args: []any{1, 2}},
+				{Name: "succ", Args: []any{2, 3}},
+				{Name: "succ", Args: []any{3, 4}},
+				{Name: "sum", Args: []any{2, 3, 5}},
+			},
+		},
+		{
+			`
+			edge(a, b).
+			edge(b, c).
+			edge(c, d).
+			dist(a, 0).
+			dist(Y, D) :- dist(X, D0), edge(X, Y), D = D0 + 1.
+			dist(X, D)?
+			`,
+			[]Atom{
+				{Name: "dist", Args: []any{String("a"), 0}},
+				{Name: "dist", Args: []any{String("b"), 1}},
+				{Name: "dist", Args: []any{String("c"), 2}},
+				{Name: "dist", Args: []any{String("d"), 3}},
+			},
+		},
+		// magic sets
+		{
+			`
+			edge(a, b).
+			edge(b, c).
+			edge(x, y).
+			path(X, Y) :- edge(X, Y).
+			path(X, Y) :- path(X, Z), edge(Z, Y).
+			safe(X, Y) :- path(X, Y), !path(Y, c).
+			path(a, X)?
+			safe(a, Y)?
+			`,
+			[]Atom{
+				{Name: "path", Args: []any{String("a"), String("b")}},
+				{Name: "path", Args: []any{String("a"), String("c")}},
+				{Name: "safe", Args: []any{String("a"), String("c")}},
+			},
+		},
+	}
+	for _, tt := range testCases {
+		db := NewDatabase()
+		db.Strategy = BottomUp
+		result, err := evalString(tt.input, db)
+
+		sort.Slice(result, func(i, j int) bool {
+			return result[i].String() < result[j].String()
+		})
+
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("for:\n%v\nexpected: %v, got: %v", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestBottomUpLongChain(t *testing.T) {
+	var code strings.Builder
+	code.WriteString("#strategy bottomup\n")
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&code, "parent(%d, %d).\n", i, i+1)
+	}
+	code.WriteString("ancestor(X, Y) :- parent(X, Y).\n")
+	code.WriteString("ancestor(X, Y) :- ancestor(X, Z), parent(Z, Y).\n")
+	code.WriteString("ancestor(X, Y)?\n")
+
+	result, err := evalString(code.String(), NewDatabase())
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if len(result) != 50*51/2 {
+		t.Errorf("wrong number of results: %d", len(result))
+	}
+}
+
+func TestTabling(t *testing.T) {
+	var testCases = []struct {
+		input    string
+		expected []Atom
+	}{
+		// left recursion
+		{
+			`
+			#table ancestor/2
+			parent(xerces, brooke).
+			parent(brooke, damocles).
+			ancestor(X, Y) :- parent(X, Y).
+			ancestor(X, Y) :- ancestor(X, Z), parent(Z, Y).
+			ancestor(xerces, X)?
+			`,
+			[]Atom{
+				{Name: "ancestor", Args: []any{String("xerces"), String("brooke")}},
+				{Name: "ancestor", Args: []any{String("xerces"), String("damocles")}},
+			},
+		},
+		// cycles in the data
+		{
+			`
+			#table path/2
+			edge(a, b).
+			edge(b, c).
+			edge(c, a).
+			path(X, Y) :- edge(X, Y).
+			path(X, Y) :- path(X, Z), path(Z, Y).
+			path(b, X)?
+			`,
+			[]Atom{
+				{Name: "path", Args: []any{String("b"), String("a")}},
+				{Name: "path", Args: []any{String("b"), String("b")}},
+				{Name: "path", Args: []any{String("b"), String("c")}},
+			},
+		},
+		// mutual recursion with negation of a tabled relation
+		{
+			`
+			#table even/1
+			#table odd/1
+			num(0).
+			num(1).
+			num(2).
+			num(3).
+			succ(0, 1).
+			succ(1, 2).
+			succ(2, 3).
+			even(0).
+			even(Y) :- odd(X), succ(X, Y).
+			odd(Y) :- even(X), succ(X, Y).
+			notodd(X) :- num(X), !odd(X).
+			notodd(X)?
+			`,
+			[]Atom{
+				{Name: "notodd", Args: []any{0}},
+				{Name: "notodd", Args: []any{2}},
+			},
+		},
+	}
+	for _, tt := range testCases {
+		result, err := evalString(tt.input, NewDatabase())
+
+		sort.Slice(result, func(i, j int) bool {
+			return result[i].String() < result[j].String()
+		})
+
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("for:\n%v\nexpected: %v, got: %v", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestTablingLongChain(t *testing.T) {
+	var code strings.Builder
+	code.WriteString("#table ancestor/2\n")
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&code, "parent(%d, %d).\n", i, i+1)
+	}
+	code.WriteString("ancestor(X, Y) :- parent(X, Y).\n")
+	code.WriteString("ancestor(X, Y) :- ancestor(X, Z), ancestor(Z, Y).\n")
+	code.WriteString("ancestor(0, Y)?\n")
+
+	result, err := evalString(code.String(), NewDatabase())
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if len(result) != 20 {
+		t.Errorf("wrong number of results: %d", len(result))
+	}
+}
+
+func TestIndex(t *testing.T) {
+	input := `
+	#index edge(_, +)
+	edge(a, b).
+	edge(b, c).
+	edge(d, c).
+	edge(X, X) :- node(X).
+	node(c).
+	from(X, Y) :- edge(X, Z), edge(Z, Y).
+	edge(X, c)?
+	edge(b, c)~
+	from(X, c)?
+	`
+	for _, strategy := range []Strategy{TopDown, BottomUp} {
+		db := NewDatabase()
+		db.Strategy = strategy
+		db.Order = Sorted
+		result, err := evalString(input, db)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		expected := []Atom{
+			{Name: "edge", Args: []any{String("b"), String("c")}},
+			{Name: "edge", Args: []any{String("c"), String("c")}},
+			{Name: "edge", Args: []any{String("d"), String("c")}},
+			{Name: "from", Args: []any{String("c"), String("c")}},
+			{Name: "from", Args: []any{String("d"), String("c")}},
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("for %v expected: %v, got: %v", strategy, expected, result)
+		}
+	}
+}
+
+func TestMaterialize(t *testing.T) {
+	input := `
+	#materialize ancestor
+	parent(a, b).
+	parent(b, c).
+	parent(c, d).
+	parent(a, c).
+	ancestor(X, Y) :- parent(X, Y).
+	ancestor(X, Y) :- parent(X, Z), ancestor(Z, Y).
+	parent(b, c)~
+	ancestor(X, Y)?
+	`
+	db := NewDatabase()
+	db.Order = Sorted
+	result, err := evalString(input, db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []Atom{
+		{Name: "ancestor", Args: []any{String("a"), String("b")}},
+		{Name: "ancestor", Args: []any{String("a"), String("c")}},
+		{Name: "ancestor", Args: []any{String("a"), String("d")}},
+		{Name: "ancestor", Args: []any{String("c"), String("d")}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected: %v, got: %v", expected, result)
+	}
+}
+
+func TestSortedOrder(t *testing.T) {
+	input := `
+	#order sorted
+	edge(b, c).
+	edge(a, b).
+	edge(a, 2).
+	edge(c, d).
+	edge(a, c).
+	path(X, Y) :- edge(X, Y).
+	path(X, Y) :- edge(X, Z), path(Z, Y).
+	path(a, X)?
+	`
+	for _, strategy := range []Strategy{TopDown, BottomUp} {
+		db := NewDatabase()
+		db.Strategy = strategy
+		result, err := evalString(input, db)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		expected := []Atom{
+			{Name: "path", Args: []any{String("a"), 2}},
+			{Name: "path", Args: []any{String("a"), String("b")}},
+			{Name: "path", Args: []any{String("a"), String("c")}},
+			{Name: "path", Args: []any{String("a"), String("d")}},
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("for %v expected: %v, got: %v", strategy, expected, result)
+		}
+	}
+}
+
+func TestFloats(t *testing.T) {
+	input := `
+	#order sorted
+	price(apple, 0.5).
+	price(pear, 1.25).
+	price(plum, 2).
+	price(fig, 2.0).
+	price(melon, -3.5e+2).
+	cheap(X) :- price(X, P), P < 1.5, P >= 0.
+	exactly(X) :- price(X, P), P = 2.
+	half(X, H) :- price(X, P), P > 1, H = P / 2.
+	total(S) :- S = sum P : { price(_, P) }.
+	top(M) :- M = max P : { price(_, P) }.
+	prices(P) :- price(_, P).
+	cheap(X)?
+	exactly(X)?
+	half(X, H)?
+	total(S)?
+	top(M)?
+	prices(P)?
+	`
+	for _, strategy := range []Strategy{TopDown, BottomUp} {
+		db := NewDatabase()
+		db.Strategy = strategy
+		result, err := evalString(input, db)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		expected := []Atom{
+			{Name: "cheap", Args: []any{String("apple")}},
+			{Name: "cheap", Args: []any{String("pear")}},
+			{Name: "exactly", Args: []any{String("plum")}},
+			{Name: "half", Args: []any{String("fig"), Float(1)}},
+			{Name: "half", Args: []any{String("pear"), Float(0.625)}},
+			{Name: "half", Args: []any{String("plum"), 1}},
+			{Name: "total", Args: []any{Float(-344.25)}},
+			{Name: "top", Args: []any{Float(2)}},
+			{Name: "prices", Args: []any{Float(-350)}},
+			{Name: "prices", Args: []any{Float(0.5)}},
+			{Name: "prices", Args: []any{Float(1.25)}},
+			{Name: "prices", Args: []any{2}},
+			{Name: "prices", Args: []any{Float(2)}},
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("for %v expected: %v, got: %v", strategy, expected, result)
+		}
+	}
+}
+
+func TestBagSemantics(t *testing.T) {
+	input := `
+	edge(a, b).
+	edge(a, c).
+	edge(b, d).
+	edge(c, d).
+	path(X, Y) :- edge(X, Y).
+	path(X, Y) :- edge(X, Z), path(Z, Y).
+	path(a, d)?
+	#bag
+	path(a, d)?
+	`
+	db := NewDatabase()
+	result, err := evalString(input, db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	answer := Atom{Name: "path", Args: []any{String("a"), String("d")}}
+	expected := []Atom{answer, answer, answer}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected: %v, got: %v", expected, result)
+	}
+}
+
+func TestCompoundTerms(t *testing.T) {
+	input := `
+	#order sorted
+	at(alice, point(1, 2)).
+	at(bob, point(3, 4)).
+	at(carol, home).
+	lives(alice, address(paris, "75001")).
+	moved(P, point(X + 1, Y)) :- at(P, point(X, Y)).
+	city(P, C) :- lives(P, A), A = address(C, _).
+	cyclic(P) :- at(P, _), X = f(X).
+	at(W, point(1, Y))?
+	moved(P, Q)?
+	city(P, C)?
+	cyclic(P)?
+	`
+	point := func(x, y int) Compound {
+		return Compound{Functor: "point", Args: []any{x, y}}
+	}
+	for _, strategy := range []Strategy{TopDown, BottomUp} {
+		db := NewDatabase()
+		db.Strategy = strategy
+		result, err := evalString(input, db)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		expected := []Atom{
+			{Name: "at", Args: []any{String("alice"), point(1, 2)}},
+			{Name: "moved", Args: []any{String("alice"), point(2, 2)}},
+			{Name: "moved", Args: []any{String("bob"), point(4, 4)}},
+			{Name: "city", Args: []any{String("alice"), String("paris")}},
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("for %v expected: %v, got: %v", strategy, expected, result)
+		}
+	}
+}
+
+func TestCompoundTermsDepthLimit(t *testing.T) {
+	input := `
+	nat(zero).
+	nat(s(X)) :- nat(X).
+	nat(X)?
+	`
+	for _, strategy := range []Strategy{TopDown, BottomUp} {
+		db := NewDatabase()
+		db.Strategy = strategy
+		_, err := evalString(input, db)
+		if _, ok := err.(TooDeep); !ok {
+			t.Errorf("for %v expected an error, got: %v", strategy, err)
+		}
+	}
+}
+
+func TestLists(t *testing.T) {
+	input := `
+	#order sorted
+	edge(a, b). edge(b, c). edge(a, c). edge(c, d).
+	path(X, Y, [X, Y]) :- edge(X, Y).
+	path(X, Z, [X | P]) :- edge(X, Y), path(Y, Z, P), !member(X, P).
+	hops(P, N) :- path(a, d, P), length(P, L), N = L - 1.
+	tags(post1, [go, datalog]).
+	tags(post2, []).
+	tagged(T, P) :- tags(P, Ts), member(T, Ts).
+	first(P, T) :- tags(P, [T | _]).
+	halves(A, B) :- tags(post1, Ts), append(A, B, Ts).
+	hops(P, N)?
+	tagged(T, P)?
+	first(P, T)?
+	halves(A, B)?
+	`
+	list := func(elems ...string) any {
+		var args []any
+		for _, elem := range elems {
+			args = append(args, String(elem))
+		}
+		return NewList(args, nil)
+	}
+	for _, strategy := range []Strategy{TopDown, BottomUp} {
+		db := NewDatabase()
+		db.Strategy = strategy
+		result, err := evalString(input, db)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		expected := []Atom{
+			{Name: "hops", Args: []any{list("a", "b", "c", "d"), 3}},
+			{Name: "hops", Args: []any{list("a", "c", "d"), 2}},
+			{Name: "tagged", Args: []any{String("datalog"), String("post1")}},
+			{Name: "tagged", Args: []any{String("go"), String("post1")}},
+			{Name: "first", Args: []any{String("post1"), String("go")}},
+			{Name: "halves", Args: []any{Nil, list("go", "datalog")}},
+			{Name: "halves", Args: []any{list("go"), list("datalog")}},
+			{Name: "halves", Args: []any{list("go", "datalog"), Nil}},
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("for %v expected: %v, got: %v", strategy, expected, result)
+		}
+	}
+}
+
+func TestPartialLists(t *testing.T) {
+	input := `
+	#order sorted
+	p(a). p(c).
+	q(X) :- p(X), member(X, [Y, b]).
+	r(L) :- p(X), append([X], T, L), T = [z].
+	q(X)?
+	r(L)?
+	`
+	for _, strategy := range []Strategy{TopDown, BottomUp} {
+		db := NewDatabase()
+		db.Strategy = strategy
+		result, err := evalString(input, db)
+		if err != nil {
+			t.Fatalf("for %v unexpected error: %s", strategy, err)
+		}
+		var atoms []string
+		for _, atom := range result {
+			atoms = append(atoms, atom.String())
+		}
+		expected := []string{"q(a)", "q(c)", "r([a, z])", "r([c, z])"}
+		if !reflect.DeepEqual(atoms, expected) {
+			t.Errorf("for %v expected: %v, got: %v", strategy, expected, atoms)
+		}
+	}
+}
+
+func TestListsCyclicPaths(t *testing.T) {
+	input := `
+	#strategy bottomup
+	#order sorted
+	edge(a, b). edge(b, c). edge(c, a).
+	path(X, Y, [X, Y]) :- edge(X, Y).
+	path(X, Z, [X | P]) :- edge(X, Y), path(Y, Z, P), !member(X, P).
+	path(a, Y, P)?
+	`
+	result, err := evalString(input, NewDatabase())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var paths []string
+	for _, atom := range result {
+		paths = append(paths, atom.String())
+	}
+	expected := []string{
+		"path(a, b, [a, b])",
+		"path(a, c, [a, b, c])",
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected: %v, got: %v", expected, paths)
+	}
+}
+
+func TestStrings(t *testing.T) {
+	input := `
+	#order sorted
+	user(1, "Alice Smith", "alice@example.com").
+	user(2, "Bob Jones", "BOB@example.org").
+	domain(Id, D) :- user(Id, _, Email), cat(_, Rest, Email), cat("@", D, Rest).
+	handle(Id, H) :- user(Id, Name, _), split(Name, " ", First), substr(First, 0, 3, P), lower(P, L), cat(L, Id, H).
+	short(Id) :- user(Id, Name, _), strlen(Name, N), N < 10.
+	parsed(N) :- to_number("1e3", N).
+	domain(Id, D)?
+	handle(Id, H)?
+	short(Id)?
+	parsed(N)?
+	`
+	for _, strategy := range []Strategy{TopDown, BottomUp} {
+		db := NewDatabase()
+		db.Strategy = strategy
+		result, err := evalString(input, db)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var atoms []string
+		for _, atom := range result {
+			atoms = append(atoms, atom.String())
+		}
+		expected := []string{
+			`domain(1, "example.com")`,
+			`domain(2, "example.org")`,
+			"handle(1, ali1)",
+			"handle(1, smi1)",
+			"handle(2, bob2)",
+			"handle(2, jon2)",
+			"short(2)",
+			"parsed(1000.0)",
+		}
+		if !reflect.DeepEqual(atoms, expected) {
+			t.Errorf("for %v expected: %v, got: %v", strategy, expected, atoms)
+		}
+	}
+}
+
+func TestRegexps(t *testing.T) {
+	input := `
+	#order sorted
+	user(alice, "alice@corp.com").
+	user(bob, "bob@example.com").
+	user(carol, "carol.smith@corp.com").
+	user(dave, "Dave@CORP.com").
+	pattern(corp, "^[a-z]+@corp\.com$").
+	corp(X) :- user(X, E), E matches "^[a-z]+@corp\.com$".
+	same(X) :- user(X, E), pattern(corp, P), E matches P.
+	other(X) :- user(X, E), !corp(X), E matches "corp".
+	login(X, L) :- user(X, E), regex_capture(E, "^([^@]+)@", 1, L).
+	corp(X)?
+	same(X)?
+	other(X)?
+	login(X, L)?
+	`
+	for _, strategy := range []Strategy{TopDown, BottomUp} {
+		db := NewDatabase()
+		db.Strategy = strategy
+		result, err := evalString(input, db)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var atoms []string
+		for _, atom := range result {
+			atoms = append(atoms, atom.String())
+		}
+		expected := []string{
+			"corp(alice)",
+			"same(alice)",
+			"other(carol)",
+			"login(alice, alice)",
+			"login(bob, bob)",
+			`login(carol, "carol.smith")`,
+			"login(dave, Dave)",
+		}
+		if !reflect.DeepEqual(atoms, expected) {
+			t.Errorf("for %v expected: %v, got: %v", strategy, expected, atoms)
+		}
+	}
+}
+
+func TestUnboundString(t *testing.T) {
+	for _, strategy := range []Strategy{TopDown, BottomUp} {
+		db := NewDatabase()
+		db.Strategy = strategy
+		_, err := evalString("name(N) :- upper(N, U).\nname(N)?", db)
+		if err == nil {
+			t.Errorf("for %v expected an error", strategy)
+		}
+	}
+}
+
+func TestBottomUpUnboundConstraint(t *testing.T) {
+	db := NewDatabase()
+	db.Strategy = BottomUp
+	_, err := evalString("less(A, B) :- A < B.\nless(1, 3)?", db)
+	if err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestUnboundList(t *testing.T) {
+	for _, strategy := range []Strategy{TopDown, BottomUp} {
+		db := NewDatabase()
+		db.Strategy = strategy
+		_, err := evalString("tag(T) :- member(T, Ts).\ntag(T)?", db)
+		if err == nil {
+			t.Errorf("for %v expected an error", strategy)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	var testCases = []struct {
+		input, expected string
+	}{
+		{
+			"foo(X) :- bar(X), !baz(X, Y).",
+			"variable Y is not bound by any atom in: foo(X) :- bar(X), !baz(X, Y)",
+		},
+		{
+			`
+			p(X) :- q(X), !r(X).
+			r(X) :- q(X), p(X).
+			p(X)?
+			`,
+			"negation through recursion: p -> r -> p",
+		},
+		{
+			`
+			p(X) :- q(X), !p(X).
+			p(X)?
+			`,
+			"negation through recursion: p -> p",
+		},
+		{
+			`
+			p(X, N) :- q(X), N = count : { p(_, _) }.
+			p(X, N)?
+			`,
+			"aggregation through recursion: p -> p",
+		},
+		{
+			`
+			num(0).
+			inv(X, Y) :- num(X), Y = 1 / X.
+			inv(X, Y)?
+			`,
+			"division by zero: 1 / 0",
+		},
+		{
+			`
+			num(a).
+			inc(X, Y) :- num(X), Y = X + 1.
+			inc(X, Y)?
+			`,
+			"cannot apply + to a and 1",
+		},
+		{
+			"length([a], 1).",
+			"length is a built-in predicate and cannot be redefined",
+		},
+		{
+			`user(X) :- name(X), X matches "(".`,
+			"invalid regular expression \"(\": error parsing regexp: missing closing ): `(`",
+		},
+		{
+			`
+			name(alice). pattern("[").
+			user(X) :- name(X), pattern(P), X matches P.
+			user(X)?
+			`,
+			"invalid regular expression \"[\": error parsing regexp: missing closing ]: `[`",
+		},
+	}
+	for _, tt := range testCases {
+		for _, strategy := range []Strategy{TopDown, BottomUp} {
+			db := NewDatabase()
+			db.Strategy = strategy
+			_, err := evalString(tt.input, db)
+			if err == nil {
+				t.Errorf("for:\n%v\nexpected an error", tt.input)
+				continue
+			}
+			if err.Error() != tt.expected {
+				t.Errorf("for:\n%v\nexpected: %q, got: %q", tt.input, tt.expected, err)
+			}
+		}
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kb.dl")
+
+	input := fmt.Sprintf(`
+	parent(xerces, brooke).
+	parent(brooke, damocles).
+	ancestor(X, Y) :- parent(X, Y).
+	ancestor(X, Y) :- parent(X, Z), ancestor(Z, Y).
+	#save %q
+	`, path)
+	if _, err := evalString(input, NewDatabase()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	input = fmt.Sprintf(`
+	#load %q
+	ancestor(xerces, X)?
+	`, path)
+	result, err := evalString(input, NewDatabase())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].String() < result[j].String()
+	})
+
+	expected := []Atom{
+		{
+			Name: "ancestor",
+			Args: []any{String("xerces"), String("brooke")},
+		},
+		{
+			Name: "ancestor",
+			Args: []any{String("xerces"), String("damocles")},
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected: %v, got: %v", expected, result)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	dir := t.TempDir()
+	all := filepath.Join(dir, "ancestor.csv")
+	pattern := filepath.Join(dir, "xerces.tsv")
+
+	input := fmt.Sprintf(`
+	parent(xerces, brooke).
+	parent(brooke, "damocles, jr.").
+	parent(brooke, 42).
+	ancestor(X, Y) :- parent(X, Y).
+	ancestor(X, Y) :- parent(X, Z), ancestor(Z, Y).
+	#output ancestor(dest=%q)
+	#output ancestor(xerces, Y, dest=%q)
+	`, all, pattern)
+	if _, err := evalString(input, NewDatabase()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var testCases = []struct {
+		path, expected string
+	}{
+		{
+			all,
+			"brooke,42\n" +
+				"brooke,\"damocles, jr.\"\n" +
+				"xerces,42\n" +
+				"xerces,brooke\n" +
+				"xerces,\"damocles, jr.\"\n",
+		},
+		{
+			pattern,
+			"xerces\t42\n" +
+				"xerces\tbrooke\n" +
+				"xerces\tdamocles, jr.\n",
+		},
+	}
+	for _, tt := range testCases {
+		data, err := os.ReadFile(tt.path)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(data) != tt.expected {
+			t.Errorf("for %s expected:\n%s\ngot:\n%s", tt.path, tt.expected, data)
+		}
+	}
+}
+
+func TestOutputRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.csv")
+	input := fmt.Sprintf(`
+	f("42", 1.5, " x").
+	f("", -3, "x,y").
+	#output f(dest=%q)
+	#input g(source=%q)
+	g(A, B, C)?
+	`, path, path)
+	result, err := evalString(input, NewDatabase())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].String() < result[j].String()
+	})
+
+	expected := []Atom{
+		{
+			Name: "g",
+			Args: []any{String(""), -3, String("x,y")},
+		},
+		{
+			Name: "g",
+			Args: []any{String("42"), Float(1.5), String(" x")},
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected: %v, got: %v", expected, result)
+	}
+}
+
+func TestInput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "people.csv")
+	data := "# exported data\r\n" +
+		"name,city,age\r\n" +
+		"\"Smith, John\",Boston,42\r\n" +
+		"Alice,\"New\nYork\",\"7\"\r\n" +
+		"Bob,Paris,41.5\r\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	input := fmt.Sprintf(`
+	#input person(source=%q, skip=1, header=true, columns="age,name")
+	person(Age, Name)?
+	`, path)
+	result, err := evalString(input, NewDatabase())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].String() < result[j].String()
+	})
+
+	expected := []Atom{
+		{
+			Name: "person",
+			Args: []any{Float(41.5), String("Bob")},
+		},
+		{
+			Name: "person",
+			Args: []any{42, String("Smith, John")},
+		},
+		{
+			Name: "person",
+			Args: []any{String("7"), String("Alice")},
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected: %v, got: %v", expected, result)
+	}
+}
+
+func evalAndCollect(query any, db *Database) ([]Atom, error) {
+	ch := make(chan Result)
 	if err := eval.Eval(query, db, ch); err != nil {
 		return nil, fmt.Errorf("unexpected error: %s", err)
 	}
 	var results []Atom
 	for val := range ch {
-		results = append(results, val)
+		if val.Err != nil {
+			return nil, fmt.Errorf("unexpected error: %s", val.Err)
+		}
+		results = append(results, val.Atom)
 	}
 	return results, nil
 }
 
-func evalString(code string, db Database) ([]Atom, error) {
+func evalString(code string, db *Database) ([]Atom, error) {
 	var result []Atom
 	parser := parser.NewParser(strings.NewReader(code))
 	for {
@@ -539,20 +1641,23 @@ func evalString(code string, db Database) ([]Atom, error) {
 			return nil, err
 		}
 
-		ch := make(chan Atom)
+		ch := make(chan Result)
 		if err = eval.Eval(expr, db, ch); err != nil {
 			return nil, err
 		}
 		if _, ok := expr.(Query); ok {
 			for val := range ch {
-				result = append(result, val)
+				if val.Err != nil {
+					return nil, val.Err
+				}
+				result = append(result, val.Atom)
 			}
 		}
 	}
 }
 
-func newDatabaseFrom(clauses ...HasKey) Database {
-	db := make(Database)
+func newDatabaseFrom(clauses ...HasKey) *Database {
+	db := NewDatabase()
 	for _, clause := range clauses {
 		db.Assert(clause)
 	}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"io"
 	"os"
@@ -9,23 +10,51 @@ import (
 	"github.com/twolodzko/datalogo/datalog"
 	"github.com/twolodzko/datalogo/eval"
 	"github.com/twolodzko/datalogo/parser"
+	"github.com/twolodzko/datalogo/wal"
 )
 
 func main() {
-	db := make(datalog.Database)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-h|--help] [-wal DIR] [-sync POLICY] [-workers N] [FILE]...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	walDir := flag.String("wal", "", "directory of the write-ahead log, the database is restored from it on start")
+	syncPolicy := flag.String("sync", "always", "when to fsync the write-ahead log: always, interval, or never")
+	workers := flag.Int("workers", 0, "maximal number of goroutines evaluating a query, GOMAXPROCS if 0, 1 for sequential evaluation")
+	flag.Parse()
 
-	if len(os.Args) > 1 {
-		if os.Args[1] == "-h" || os.Args[1] == "--help" {
-			fmt.Printf("usage: %s [-h|--help] [FILE]...\n", os.Args[0])
-			return
+	db := datalog.NewDatabase()
+	db.Workers = *workers
+
+	if *walDir != "" {
+		opts := wal.Options{CompactEvery: 10000}
+		switch *syncPolicy {
+		case "always":
+			opts.Sync = wal.SyncAlways
+		case "interval":
+			opts.Sync = wal.SyncInterval
+		case "never":
+			opts.Sync = wal.SyncNever
+		default:
+			printError(fmt.Errorf("invalid sync policy: %s", *syncPolicy))
+			os.Exit(2)
 		}
-		evalFiles(os.Args[1:], db)
+		log, err := wal.Open(*walDir, db, opts)
+		if err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		defer log.Close()
+	}
+
+	if flag.NArg() > 0 {
+		evalFiles(flag.Args(), db)
 	} else {
 		repl(db)
 	}
 }
 
-func repl(db datalog.Database) {
+func repl(db *datalog.Database) {
 	fmt.Println("Press ^C to exit.")
 	fmt.Println()
 
@@ -41,18 +70,22 @@ func repl(db datalog.Database) {
 			continue
 		}
 
-		out := make(chan datalog.Atom)
+		out := make(chan datalog.Result)
 		if err := eval.Eval(expr, db, out); err != nil {
 			printError(err)
 		} else {
 			for result := range out {
-				fmt.Println(result)
+				if result.Err != nil {
+					printError(result.Err)
+				} else {
+					printResult(result)
+				}
 			}
 		}
 	}
 }
 
-func evalFiles(paths []string, db datalog.Database) {
+func evalFiles(paths []string, db *datalog.Database) {
 	for _, path := range paths {
 		file, err := os.Open(path)
 		if err != nil {
@@ -70,19 +103,34 @@ func evalFiles(paths []string, db datalog.Database) {
 				printError(err)
 				return
 			}
-			out := make(chan datalog.Atom)
+			out := make(chan datalog.Result)
 			if err := eval.Eval(expr, db, out); err != nil {
 				printError(err)
 				return
 			} else {
 				for result := range out {
-					fmt.Println(result)
+					if result.Err != nil {
+						printError(result.Err)
+						return
+					}
+					printResult(result)
 				}
 			}
 		}
 	}
 }
 
+// Print the result, or its proof or plan if it was asked for.
+func printResult(result datalog.Result) {
+	if result.Proof != nil {
+		fmt.Println(result.Proof)
+	} else if result.Plan != nil {
+		fmt.Println(result.Plan)
+	} else {
+		fmt.Println(result)
+	}
+}
+
 func printError(msg error) {
 	fmt.Printf("error: %s\n", msg)
 }
@@ -0,0 +1,185 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/twolodzko/datalogo/datalog"
+)
+
+// Save the database to the file.
+//
+//	#save "kb.dl"
+type Save struct {
+	Path string
+}
+
+// Load the database from the file saved with #save.
+//
+//	#load "kb.dl"
+type Load struct {
+	Path string
+}
+
+// Evaluate the predicate using tabling.
+//
+//	#table ancestor/2
+type Table struct {
+	Name  string
+	Arity int
+}
+
+func (p *Parser) readTable() (Table, error) {
+	name, err := p.readToken()
+	if err != nil {
+		return Table{}, err
+	}
+	if !isIdentifier(name) {
+		return Table{}, UnexpectedToken{name}
+	}
+	if err := p.expect("/"); err != nil {
+		return Table{}, err
+	}
+	token, err := p.readToken()
+	if err != nil {
+		return Table{}, err
+	}
+	arity, err := strconv.Atoi(token)
+	if err != nil || arity < 0 {
+		return Table{}, UnexpectedToken{token}
+	}
+	return Table{name, arity}, nil
+}
+
+// Materialize the relation, so its facts are derived in advance
+// and maintained incrementally.
+//
+//	#materialize ancestor
+type Materialize struct {
+	Name string
+}
+
+func (p *Parser) readMaterialize() (Materialize, error) {
+	name, err := p.readToken()
+	if err != nil {
+		return Materialize{}, err
+	}
+	if !isIdentifier(name) {
+		return Materialize{}, UnexpectedToken{name}
+	}
+	return Materialize{name}, nil
+}
+
+// Index the predicate on the arguments marked with +.
+//
+//	#index edge(_, +)
+type Index struct {
+	Name      string
+	Arity     int
+	Positions []int
+}
+
+func (p *Parser) readIndex() (Index, error) {
+	name, err := p.readToken()
+	if err != nil {
+		return Index{}, err
+	}
+	if !isIdentifier(name) {
+		return Index{}, UnexpectedToken{name}
+	}
+	if err := p.expect("("); err != nil {
+		return Index{}, err
+	}
+	index := Index{Name: name}
+	for {
+		token, err := p.readToken()
+		if err != nil {
+			return Index{}, err
+		}
+		switch token {
+		case "+":
+			index.Positions = append(index.Positions, index.Arity)
+		case "_":
+		default:
+			return Index{}, UnexpectedToken{token}
+		}
+		index.Arity++
+
+		token, err = p.readToken()
+		if err != nil {
+			return Index{}, err
+		}
+		switch token {
+		case ",":
+		case ")":
+			if len(index.Positions) == 0 {
+				return Index{}, fmt.Errorf("index of %s/%d has no positions", name, index.Arity)
+			}
+			return index, nil
+		default:
+			return Index{}, UnexpectedToken{token}
+		}
+	}
+}
+
+// Print the plan of the top-down evaluation of the query,
+// the trailing "?" is optional.
+//
+//	#explain path(a, X)?
+type Explain struct {
+	Query datalog.Atom
+}
+
+func (p *Parser) readExplain() (Explain, error) {
+	query, err := p.readDirectiveQuery()
+	return Explain{query}, err
+}
+
+// Print the proofs of the answers to the query, the trailing "?" is optional.
+//
+//	#why path(a, X)?
+type Why struct {
+	Query datalog.Atom
+}
+
+func (p *Parser) readWhy() (Why, error) {
+	query, err := p.readDirectiveQuery()
+	return Why{query}, err
+}
+
+// Read the query used as the argument of the directive.
+func (p *Parser) readDirectiveQuery() (datalog.Atom, error) {
+	name, err := p.readToken()
+	if err != nil {
+		return datalog.Atom{}, err
+	}
+	if !isIdentifier(name) {
+		return datalog.Atom{}, UnexpectedToken{name}
+	}
+	if err := p.expect("("); err != nil {
+		return datalog.Atom{}, err
+	}
+	args, err := p.readArgs()
+	if err != nil {
+		return datalog.Atom{}, err
+	}
+	args, err = foldArgs(args)
+	if err != nil {
+		return datalog.Atom{}, err
+	}
+	if err := p.skipOnLine('?'); err != nil {
+		return datalog.Atom{}, err
+	}
+	return datalog.Atom{Name: name, Args: args}, nil
+}
+
+func (p *Parser) readPath() (string, error) {
+	val, err := p.readTerm()
+	if err != nil {
+		return "", err
+	}
+	if path, ok := val.(datalog.String); ok {
+		return parsePath(string(path))
+	}
+	return "", WrongValue{"path", val}
+}
@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"fmt"
+
+	//lint:ignore ST1001 this is an internal dependency
+	. "github.com/twolodzko/datalogo/datalog"
+)
+
+// Create the rule, where the arithmetic expressions used as arguments
+// of the atoms are replaced with variables bound by the constraints,
+// e.g. `succ(X, X + 1) :- num(X).` becomes `succ(X, _E0) :- num(X), _E0 = (X + 1).`
+func newRule(head Atom, body []Evaluable) Rule {
+	var (
+		n    int
+		tail []Evaluable
+	)
+	head, tail = extractExprs(head, &n)
+	body = normalizeBody(body, &n)
+	return Rule{
+		Atom: head,
+		Body: append(body, tail...),
+	}
+}
+
+func normalizeBody(body []Evaluable, n *int) []Evaluable {
+	var out []Evaluable
+	for _, lit := range body {
+		switch lit := lit.(type) {
+		case Atom:
+			atom, constraints := extractExprs(lit, n)
+			out = append(out, atom)
+			out = append(out, constraints...)
+		case Negation:
+			// the constraints need to bind the variables before the negation
+			atom, constraints := extractExprs(lit.Atom, n)
+			out = append(out, constraints...)
+			out = append(out, Negation{Atom: atom})
+		case Aggregate:
+			lit.Body = normalizeBody(lit.Body, n)
+			out = append(out, lit)
+		default:
+			out = append(out, lit)
+		}
+	}
+	optimizeBody(out)
+	return out
+}
+
+// Replace the arithmetic expressions in the arguments with new variables
+// and return the constraints binding them. Constant expressions are
+// replaced with their values.
+func extractExprs(atom Atom, n *int) (Atom, []Evaluable) {
+	var (
+		args        []any
+		constraints []Evaluable
+	)
+	for _, arg := range atom.Args {
+		args = append(args, extractTerm(arg, n, &constraints))
+	}
+	return Atom{Name: atom.Name, Args: args}, constraints
+}
+
+// Replace the arithmetic expressions in the term, including
+// the arguments of the compound terms, see extractExprs.
+func extractTerm(term any, n *int, constraints *[]Evaluable) any {
+	switch term := term.(type) {
+	case Expr:
+		if val, err := (Vars{}).Compute(term); err == nil {
+			return val
+		}
+		v := Var{Name: fmt.Sprintf("_E%d", *n)}
+		*n++
+		*constraints = append(*constraints, Constraint{
+			Op:  "=",
+			Lhs: v,
+			Rhs: term,
+		})
+		return v
+	case Compound:
+		var args []any
+		for _, arg := range term.Args {
+			args = append(args, extractTerm(arg, n, constraints))
+		}
+		return Compound{Functor: term.Functor, Args: args}
+	default:
+		return term
+	}
+}
+
+// Replace the arithmetic expressions in the arguments,
+// including the arguments of the compound terms, with their values.
+func foldArgs(args []any) ([]any, error) {
+	var out []any
+	for _, arg := range args {
+		switch term := arg.(type) {
+		case Expr:
+			val, err := (Vars{}).Compute(term)
+			if err != nil {
+				return nil, err
+			}
+			arg = val
+		case Compound:
+			args, err := foldArgs(term.Args)
+			if err != nil {
+				return nil, err
+			}
+			arg = Compound{Functor: term.Functor, Args: args}
+		}
+		out = append(out, arg)
+	}
+	return out, nil
+}
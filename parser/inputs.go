@@ -8,6 +8,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/twolodzko/datalogo/datalog"
 )
@@ -16,48 +17,83 @@ import (
 //
 //	#input foo(source="file.csv", delimiter=",", skip=0, columns="1:5")
 //	#input bar(source=stdin, delimiter="\t", columns="1-2,6")
+//	#input baz(source="file.csv", header=true, columns="name,age")
+//	#input event(source="events.jsonl", format=jsonl, fields="user.id,action,ts", missing=skip)
 type Input struct {
-	Name      string
-	Source    string
-	Separator string
-	Skip      int
-	Columns   []int
+	Name   string
+	Source string
+	// Format of the source: csv (also used for other delimited files), json, or jsonl.
+	Format    string
+	Separator rune
+	// Character used for quoting the fields, zero disables quoting.
+	Quote rune
+	Skip  int
+	// Use the first row (after skipping) as the header.
+	Header bool
+	// Indexes of the columns to read, all the columns when empty.
+	Columns []int
+	// Names of the columns to read, they are looked up in the header.
+	ColumnNames []string
+	// Paths of the fields read from the JSON objects, like "user.id".
+	Fields []string
+	// What to do when the JSON field is missing: error, skip the object,
+	// or use a wildcard in its place.
+	Missing string
 }
 
-func (inp Input) ParseLine(line string) (datalog.Atom, error) {
+// Create the atom from the fields of the record. The quoted
+// fields are strings, the unquoted ones are read as integers
+// if possible, otherwise as strings.
+func (inp Input) ParseRecord(fields []string, quoted []bool) (datalog.Atom, error) {
 	atom := datalog.Atom{
 		Name: inp.Name,
 	}
-	fields := strings.Split(line, inp.Separator)
-
 	if len(inp.Columns) > 0 {
 		for _, i := range inp.Columns {
 			if i >= len(fields) {
 				return datalog.Atom{}, fmt.Errorf("missing column: %d", i+1)
 			}
-			field := strings.TrimSpace(fields[i])
-			term, err := parseTerm(field)
-			if err != nil {
-				return datalog.Atom{}, err
-			}
-			atom.Args = append(atom.Args, term)
+			atom.Args = append(atom.Args, parseField(fields[i], quoted[i]))
 		}
 	} else {
-		for _, field := range fields {
-			field = strings.TrimSpace(field)
-			term, err := parseTerm(field)
-			if err != nil {
-				return datalog.Atom{}, err
-			}
-			atom.Args = append(atom.Args, term)
+		for i, field := range fields {
+			atom.Args = append(atom.Args, parseField(field, quoted[i]))
 		}
 	}
-
 	return atom, nil
 }
 
+// Find the indexes of the columns selected by name.
+func (inp Input) ResolveColumns(header []string) ([]int, error) {
+	var out []int
+	for _, name := range inp.ColumnNames {
+		i := slices.Index(header, name)
+		if i < 0 {
+			return nil, fmt.Errorf("missing column: %s", name)
+		}
+		out = append(out, i)
+	}
+	return out, nil
+}
+
+func parseField(field string, quoted bool) any {
+	if quoted {
+		return datalog.String(field)
+	}
+	field = strings.TrimSpace(field)
+	if number, ok := datalog.ParseNumber(field); ok {
+		return number
+	}
+	return datalog.String(field)
+}
+
 func (p *Parser) readInput() (Input, error) {
-	var res Input
+	var (
+		res       Input
+		separator string
+		quote     = `"`
+		columns   string
+	)
 
 	name, err := p.readToken()
 	if err != nil {
@@ -106,10 +142,49 @@ func (p *Parser) readInput() (Input, error) {
 			default:
 				return Input{}, WrongValue{key, val}
 			}
-		case "separator", "sep":
+		case "separator", "sep", "delimiter":
+			switch val := val.(type) {
+			case datalog.String:
+				separator = string(val)
+			default:
+				return Input{}, WrongValue{key, val}
+			}
+		case "quote":
 			switch val := val.(type) {
 			case datalog.String:
-				res.Separator = string(val)
+				quote = string(val)
+			default:
+				return Input{}, WrongValue{key, val}
+			}
+		case "header":
+			switch val {
+			case datalog.String("true"):
+				res.Header = true
+			case datalog.String("false"):
+				res.Header = false
+			default:
+				return Input{}, WrongValue{key, val}
+			}
+		case "format":
+			switch val {
+			case datalog.String("csv"), datalog.String("json"), datalog.String("jsonl"):
+				res.Format = string(val.(datalog.String))
+			default:
+				return Input{}, WrongValue{key, val}
+			}
+		case "fields":
+			switch val := val.(type) {
+			case datalog.String:
+				for _, field := range strings.Split(string(val), ",") {
+					res.Fields = append(res.Fields, strings.TrimSpace(field))
+				}
+			default:
+				return Input{}, WrongValue{key, val}
+			}
+		case "missing":
+			switch val {
+			case datalog.String("error"), datalog.String("skip"), datalog.String("wildcard"):
+				res.Missing = string(val.(datalog.String))
 			default:
 				return Input{}, WrongValue{key, val}
 			}
@@ -123,11 +198,7 @@ func (p *Parser) readInput() (Input, error) {
 		case "columns", "cols":
 			switch val := val.(type) {
 			case datalog.String:
-				cols, err := parseColumns(string(val))
-				if err != nil {
-					return Input{}, err
-				}
-				res.Columns = cols
+				columns = string(val)
 			default:
 				return Input{}, WrongValue{key, val}
 			}
@@ -146,12 +217,58 @@ func (p *Parser) readInput() (Input, error) {
 		}
 	}
 
-	if res.Separator == "" {
+	if res.Format == "" {
+		switch {
+		case strings.HasSuffix(res.Source, ".jsonl"):
+			res.Format = "jsonl"
+		case strings.HasSuffix(res.Source, ".json"):
+			res.Format = "json"
+		default:
+			res.Format = "csv"
+		}
+	}
+	if res.Format != "csv" && len(res.Fields) == 0 {
+		return Input{}, fmt.Errorf("fields are required for the %s format", res.Format)
+	}
+	if res.Missing == "" {
+		res.Missing = "error"
+	}
+
+	if separator == "" {
 		switch {
 		case strings.HasSuffix(res.Source, ".csv"):
-			res.Separator = ","
+			separator = ","
 		default:
-			res.Separator = "\t"
+			separator = "\t"
+		}
+	}
+	sep, size := utf8.DecodeRuneInString(separator)
+	if size != len(separator) {
+		return Input{}, WrongValue{"separator", datalog.String(separator)}
+	}
+	res.Separator = sep
+
+	if quote != "" {
+		q, size := utf8.DecodeRuneInString(quote)
+		if size != len(quote) || q == sep {
+			return Input{}, WrongValue{"quote", datalog.String(quote)}
+		}
+		res.Quote = q
+	}
+
+	if columns != "" {
+		cols, err := parseColumns(columns)
+		switch {
+		case err == nil:
+			res.Columns = cols
+		case res.Header:
+			// select the columns by the names from the header
+			res.ColumnNames = strings.Split(columns, ",")
+			for i, name := range res.ColumnNames {
+				res.ColumnNames[i] = strings.TrimSpace(name)
+			}
+		default:
+			return Input{}, err
 		}
 	}
 	if res.Source == "" {
@@ -178,11 +295,11 @@ func parseColumns(input string) ([]int, error) {
 			if err != nil {
 				return nil, err
 			}
-			upper, err := strconv.Atoi(vals[0])
+			upper, err := strconv.Atoi(vals[1])
 			if err != nil {
 				return nil, err
 			}
-			for i := lower - 1; i <= upper+1; i++ {
+			for i := lower - 1; i < upper; i++ {
 				out = append(out, i)
 			}
 		default:
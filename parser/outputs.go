@@ -0,0 +1,129 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/twolodzko/datalogo/datalog"
+)
+
+// Write all the tuples of the relation, or the ones matching the pattern,
+// to a delimited file.
+//
+// Examples:
+//
+//	#output ancestor(dest="out.csv", sep=",")
+//	#output ancestor(X, bob, dest="bob.tsv")
+type Output struct {
+	Name string
+	// Arguments of the query pattern, if empty, all the tuples are written.
+	Args      []any
+	Dest      string
+	Separator rune
+}
+
+func (p *Parser) readOutput() (Output, error) {
+	var res Output
+
+	name, err := p.readToken()
+	if err != nil {
+		return Output{}, err
+	}
+	if !isIdentifier(name) {
+		return Output{}, UnexpectedToken{name}
+	}
+	res.Name = name
+
+	// (
+	if err := p.expect("("); err != nil {
+		return Output{}, err
+	}
+
+	var separator string
+	for {
+		key, err := p.readToken()
+		if err != nil {
+			return Output{}, err
+		}
+		next, err := p.readToken()
+		if err != nil {
+			return Output{}, err
+		}
+
+		if isIdentifier(key) && next == "=" {
+			val, err := p.readTerm()
+			if err != nil {
+				return Output{}, err
+			}
+
+			switch key {
+			case "dest":
+				switch val := val.(type) {
+				case datalog.String:
+					if val == "stdout" {
+						res.Dest = string(val)
+					} else {
+						res.Dest, err = parsePath(string(val))
+						if err != nil {
+							return Output{}, err
+						}
+					}
+				default:
+					return Output{}, WrongValue{key, val}
+				}
+			case "separator", "sep":
+				switch val := val.(type) {
+				case datalog.String:
+					separator = string(val)
+				default:
+					return Output{}, WrongValue{key, val}
+				}
+			default:
+				return Output{}, fmt.Errorf("unknown key: %s", key)
+			}
+		} else {
+			// argument of the query pattern
+			p.unreadTokens(key, next)
+			arg, err := p.readExpr()
+			if err != nil {
+				return Output{}, err
+			}
+			res.Args = append(res.Args, arg)
+		}
+
+		token, err := p.readToken()
+		if err != nil {
+			return Output{}, err
+		}
+		if token == ")" {
+			break
+		} else if token != "," {
+			return Output{}, UnexpectedToken{token}
+		}
+	}
+
+	res.Args, err = foldArgs(res.Args)
+	if err != nil {
+		return Output{}, err
+	}
+
+	if res.Dest == "" {
+		res.Dest = "stdout"
+	}
+	if separator == "" {
+		switch {
+		case strings.HasSuffix(res.Dest, ".csv"):
+			separator = ","
+		default:
+			separator = "\t"
+		}
+	}
+	sep, size := utf8.DecodeRuneInString(separator)
+	if size != len(separator) {
+		return Output{}, WrongValue{"separator", datalog.String(separator)}
+	}
+	res.Separator = sep
+
+	return res, nil
+}
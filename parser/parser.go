@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io"
 	"sort"
-	"strconv"
 
 	//lint:ignore ST1001 this is an internal dependency
 	. "github.com/twolodzko/datalogo/datalog"
@@ -13,10 +12,12 @@ import (
 
 type Parser struct {
 	*bufio.Reader
+	// tokens that were read ahead and pushed back
+	buffer []string
 }
 
 func NewParser(in io.Reader) *Parser {
-	return &Parser{bufio.NewReader(in)}
+	return &Parser{Reader: bufio.NewReader(in)}
 }
 
 func (p *Parser) Next() (any, error) {
@@ -41,6 +42,32 @@ func (p *Parser) Next() (any, error) {
 		}
 	case head == "#input":
 		return p.readInput()
+	case head == "#output":
+		return p.readOutput()
+	case head == "#strategy":
+		return p.readStrategy()
+	case head == "#order":
+		return p.readOrder()
+	case head == "#set":
+		return Set, nil
+	case head == "#bag":
+		return Bag, nil
+	case head == "#table":
+		return p.readTable()
+	case head == "#index":
+		return p.readIndex()
+	case head == "#materialize":
+		return p.readMaterialize()
+	case head == "#explain":
+		return p.readExplain()
+	case head == "#why":
+		return p.readWhy()
+	case head == "#save":
+		path, err := p.readPath()
+		return Save{path}, err
+	case head == "#load":
+		path, err := p.readPath()
+		return Load{path}, err
 	default:
 		return nil, UnexpectedToken{head}
 	}
@@ -50,6 +77,18 @@ func (p *Parser) Next() (any, error) {
 		return nil, err
 	}
 
+	if token == ":-" {
+		body, err := p.readBody()
+		if err != nil {
+			return nil, err
+		}
+		return Assertion{Fact: newRule(atom, body)}, nil
+	}
+
+	atom.Args, err = foldArgs(atom.Args)
+	if err != nil {
+		return nil, err
+	}
 	switch token {
 	case ".":
 		return Assertion{Fact: atom}, nil
@@ -57,21 +96,41 @@ func (p *Parser) Next() (any, error) {
 		return Query{Query: atom}, nil
 	case "~":
 		return Retraction{Fact: atom}, nil
-	case ":-":
-		body, err := p.readBody()
-		if err != nil {
-			return nil, err
-		}
-		rule := Rule{
-			Atom: atom,
-			Body: body,
-		}
-		return Assertion{Fact: rule}, nil
 	default:
 		return nil, UnexpectedToken{token}
 	}
 }
 
+func (p *Parser) readStrategy() (Strategy, error) {
+	token, err := p.readToken()
+	if err != nil {
+		return 0, err
+	}
+	switch token {
+	case "topdown":
+		return TopDown, nil
+	case "bottomup":
+		return BottomUp, nil
+	default:
+		return 0, UnexpectedToken{token}
+	}
+}
+
+func (p *Parser) readOrder() (Order, error) {
+	token, err := p.readToken()
+	if err != nil {
+		return 0, err
+	}
+	switch token {
+	case "unordered":
+		return Unordered, nil
+	case "sorted":
+		return Sorted, nil
+	default:
+		return 0, UnexpectedToken{token}
+	}
+}
+
 func (p *Parser) readLiteral() (Evaluable, error) {
 	first, err := p.readToken()
 	if err != nil {
@@ -82,26 +141,243 @@ func (p *Parser) readLiteral() (Evaluable, error) {
 		return nil, err
 	}
 	switch {
-	case next == "(":
+	case first == "!" || (first == "not" && next != "("):
+		atom, err := p.readNegated(next)
+		return Negation{Atom: atom}, err
+	case isIdentifier(first) && next == "(":
 		args, err := p.readArgs()
 		return Atom{
 			Name: first,
 			Args: args,
 		}, err
-	case isOperator(next):
-		lhs, err := parseTerm(first)
+	default:
+		p.unreadTokens(first, next)
+		return p.readConstraint()
+	}
+}
+
+func (p *Parser) readConstraint() (Evaluable, error) {
+	lhs, err := p.readExpr()
+	if err != nil {
+		return nil, err
+	}
+	op, err := p.readToken()
+	if err != nil {
+		return nil, err
+	}
+	if !isOperator(op) {
+		return nil, UnexpectedToken{op}
+	}
+	if op == "=" {
+		agg, ok, err := p.maybeReadAggregate()
 		if err != nil {
 			return nil, err
 		}
-		rhs, err := p.readTerm()
-		return Constraint{
-			Op:  next,
-			Rhs: rhs,
-			Lhs: lhs,
-		}, err
+		if ok {
+			agg.Result = lhs
+			return agg, nil
+		}
+	}
+	rhs, err := p.readExpr()
+	return Constraint{
+		Op:  op,
+		Rhs: rhs,
+		Lhs: lhs,
+	}, err
+}
+
+// Read the arithmetic expression, where "*", "/", and "mod"
+// take precedence over "+" and "-".
+func (p *Parser) readExpr() (any, error) {
+	lhs, err := p.readProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, err := p.readToken()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case op == "+" || op == "-":
+			// expected
+		case len(op) > 1 && isNumber(op) && !isDigit(op[0]):
+			// the sign was read together with the number, like in `X -1`
+			p.unreadTokens(op[1:])
+			op = op[:1]
+		default:
+			p.unreadTokens(op)
+			return lhs, nil
+		}
+		rhs, err := p.readProduct()
+		if err != nil {
+			return nil, err
+		}
+		lhs = Expr{Op: op, Lhs: lhs, Rhs: rhs}
+	}
+}
+
+func (p *Parser) readProduct() (any, error) {
+	lhs, err := p.readFactor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, err := p.readToken()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "*", "/", "mod":
+			// expected
+		default:
+			p.unreadTokens(op)
+			return lhs, nil
+		}
+		rhs, err := p.readFactor()
+		if err != nil {
+			return nil, err
+		}
+		lhs = Expr{Op: op, Lhs: lhs, Rhs: rhs}
+	}
+}
+
+func (p *Parser) readFactor() (any, error) {
+	token, err := p.readToken()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case "-":
+		val, err := p.readFactor()
+		return Expr{Op: "-", Rhs: val}, err
+	case "(":
+		val, err := p.readExpr()
+		if err != nil {
+			return nil, err
+		}
+		return val, p.expect(")")
+	case "[":
+		return p.readList()
 	default:
-		return nil, UnexpectedToken{next}
+		if isIdentifier(token) {
+			return p.maybeReadCompound(token)
+		}
+		return parseTerm(token)
+	}
+}
+
+// Read the compound term like `point(1, 2)`, where functor is the already
+// consumed first token. If it is not followed by "(", it is a string.
+func (p *Parser) maybeReadCompound(functor string) (any, error) {
+	next, err := p.readToken()
+	if err != nil {
+		return nil, err
+	}
+	if next != "(" {
+		p.unreadTokens(next)
+		return parseTerm(functor)
+	}
+	args, err := p.readArgs()
+	return Compound{Functor: functor, Args: args}, err
+}
+
+// Read the list like `[a, b]` or `[H | T]`, after the opening "[" was consumed.
+func (p *Parser) readList() (any, error) {
+	token, err := p.readToken()
+	if err != nil {
+		return nil, err
+	}
+	if token == "]" {
+		return Nil, nil
+	}
+	p.unreadTokens(token)
+
+	var elems []any
+	for {
+		elem, err := p.readExpr()
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, elem)
+
+		token, err := p.readToken()
+		if err != nil {
+			return nil, err
+		}
+		switch token {
+		case ",":
+			// expected
+		case "]":
+			return NewList(elems, nil), nil
+		case "|":
+			tail, err := p.readExpr()
+			if err != nil {
+				return nil, err
+			}
+			return NewList(elems, tail), p.expect("]")
+		default:
+			return nil, UnexpectedToken{token}
+		}
+	}
+}
+
+// Try reading the aggregate like `count : { ... }` or `sum X : { ... }`,
+// if it is not an aggregate, push back the read tokens.
+func (p *Parser) maybeReadAggregate() (Aggregate, bool, error) {
+	fn, err := p.readToken()
+	if err != nil {
+		return Aggregate{}, false, err
+	}
+	if !isAggregate(fn) {
+		p.unreadTokens(fn)
+		return Aggregate{}, false, nil
+	}
+
+	agg := Aggregate{Func: fn}
+	token, err := p.readToken()
+	if err != nil {
+		return Aggregate{}, false, err
+	}
+	if fn != "count" {
+		next, err := p.readToken()
+		if err != nil {
+			return Aggregate{}, false, err
+		}
+		if next != ":" {
+			p.unreadTokens(fn, token, next)
+			return Aggregate{}, false, nil
+		}
+		agg.Term, err = parseTerm(token)
+		if err != nil {
+			return Aggregate{}, false, err
+		}
+	} else if token != ":" {
+		p.unreadTokens(fn, token)
+		return Aggregate{}, false, nil
+	}
+
+	if err := p.expect("{"); err != nil {
+		return Aggregate{}, false, err
+	}
+	agg.Body, err = p.readLiterals("}")
+	return agg, true, err
+}
+
+// Read the atom that follows the negation, where name
+// is the already consumed first token.
+func (p *Parser) readNegated(name string) (Atom, error) {
+	if !isIdentifier(name) {
+		return Atom{}, UnexpectedToken{name}
+	}
+	if err := p.expect("("); err != nil {
+		return Atom{}, err
 	}
+	args, err := p.readArgs()
+	return Atom{
+		Name: name,
+		Args: args,
+	}, err
 }
 
 func (p *Parser) expect(expected string) error {
@@ -116,6 +392,11 @@ func (p *Parser) expect(expected string) error {
 }
 
 func (p *Parser) readBody() ([]Evaluable, error) {
+	return p.readLiterals(".")
+}
+
+// Read the comma-separated literals until reaching the end token.
+func (p *Parser) readLiterals(end string) ([]Evaluable, error) {
 	var body []Evaluable
 	for {
 		atom, err := p.readLiteral()
@@ -131,7 +412,7 @@ func (p *Parser) readBody() ([]Evaluable, error) {
 		switch token {
 		case ",", "&":
 			// expected
-		case ".":
+		case end:
 			optimizeBody(body)
 			return body, nil
 		default:
@@ -141,20 +422,27 @@ func (p *Parser) readBody() ([]Evaluable, error) {
 }
 
 func optimizeBody(body []Evaluable) {
-	// re-order the body to put the constraints at the back
-	sort.Slice(body, func(i, j int) bool {
-		if _, ok := body[i].(Atom); ok {
-			_, ok := body[j].(Constraint)
-			return ok
+	// re-order the body to put the atoms first, and the constraints,
+	// negations, and aggregates at the back, so they are evaluated after
+	// the variables were bound, the aggregates stay after the literals
+	// written before them, since these bind their grouping keys
+	rank := func(lit Evaluable) int {
+		switch lit.(type) {
+		case Atom:
+			return 0
+		default:
+			return 1
 		}
-		return false
+	}
+	sort.SliceStable(body, func(i, j int) bool {
+		return rank(body[i]) < rank(body[j])
 	})
 }
 
 func (p *Parser) readArgs() ([]any, error) {
 	var args []any
 	for {
-		term, err := p.readTerm()
+		term, err := p.readExpr()
 		if err != nil {
 			return nil, err
 		}
@@ -195,9 +483,8 @@ func parseTerm(token string) (any, error) {
 	case token == "_":
 		return Wildcard{}, nil
 	case isNumber(token):
-		integer, err := strconv.Atoi(token)
-		if err == nil {
-			return integer, nil
+		if number, ok := ParseNumber(token); ok {
+			return number, nil
 		}
 		return String(token), nil
 	case token[0] == '"':
@@ -212,6 +499,10 @@ func parseTerm(token string) (any, error) {
 	}
 }
 
+func isDigit(b byte) bool {
+	return '0' <= b && b <= '9'
+}
+
 func isIdentifier(token string) bool {
 	return 'a' <= token[0] && token[0] <= 'z'
 }
@@ -226,7 +517,16 @@ func isNumber(token string) bool {
 
 func isOperator(token string) bool {
 	switch token {
-	case "=", "!=", "<", "<=", ">", ">=", "in":
+	case "=", "!=", "<", "<=", ">", ">=", "in", "matches":
+		return true
+	default:
+		return false
+	}
+}
+
+func isAggregate(token string) bool {
+	switch token {
+	case "count", "sum", "min", "max":
 		return true
 	default:
 		return false
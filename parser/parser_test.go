@@ -26,6 +26,21 @@ func TestReadToken(t *testing.T) {
 		{"), foo(a,", ")"},
 		{":- foo(A),", ":-"},
 		{"<= 84", "<="},
+		{"- X", "-"},
+		{"-X", "-"},
+		{"+1", "+1"},
+		{"X-1", "X"},
+		{"a-b)", "a-b"},
+		{"well-known+1,", "well-known+1"},
+		{"* 2", "*"},
+		{"/ 2", "/"},
+		{"3.14)", "3.14"},
+		{"-0.5,", "-0.5"},
+		{"1.5e-3.", "1.5e-3"},
+		{"2E+10 ", "2E+10"},
+		{"1.", "1"},
+		{"1.foo", "1"},
+		{"X.", "X"},
 	}
 
 	for _, tt := range testCases {
@@ -86,6 +101,26 @@ func TestReadTerm(t *testing.T) {
 			"2=2",
 			2,
 		},
+		{
+			"3.14",
+			Float(3.14),
+		},
+		{
+			"-2.0",
+			Float(-2),
+		},
+		{
+			"1e3",
+			Float(1000),
+		},
+		{
+			"2.5e-1.",
+			Float(0.25),
+		},
+		{
+			"1.2.3",
+			Float(1.2),
+		},
 	}
 
 	for _, tt := range testCases {
@@ -132,6 +167,14 @@ func TestReadLiteral(t *testing.T) {
 				Rhs: Var{Name: "Y"},
 			},
 		},
+		{
+			"P = point(X, 2),",
+			Constraint{
+				Op:  "=",
+				Lhs: Var{Name: "P"},
+				Rhs: Compound{Functor: "point", Args: []any{Var{Name: "X"}, 2}},
+			},
+		},
 		{
 			"1 != 1,",
 			Constraint{
@@ -140,6 +183,14 @@ func TestReadLiteral(t *testing.T) {
 				Rhs: 1,
 			},
 		},
+		{
+			`X matches "^[a-z]+$",`,
+			Constraint{
+				Op:  "matches",
+				Lhs: Var{Name: "X"},
+				Rhs: String("^[a-z]+$"),
+			},
+		},
 		{
 			"51 >= 42,",
 			Constraint{
@@ -148,6 +199,122 @@ func TestReadLiteral(t *testing.T) {
 				Rhs: 42,
 			},
 		},
+		{
+			"!foo(X),",
+			Negation{
+				Atom: Atom{
+					Name: "foo",
+					Args: []any{Var{Name: "X"}},
+				},
+			},
+		},
+		{
+			"not foo(X),",
+			Negation{
+				Atom: Atom{
+					Name: "foo",
+					Args: []any{Var{Name: "X"}},
+				},
+			},
+		},
+		{
+			"not(X),",
+			Atom{
+				Name: "not",
+				Args: []any{Var{Name: "X"}},
+			},
+		},
+		{
+			"N = count : { edge(X, _) },",
+			Aggregate{
+				Func:   "count",
+				Result: Var{Name: "N"},
+				Body: []Evaluable{
+					Atom{
+						Name: "edge",
+						Args: []any{Var{Name: "X"}, Wildcard{}},
+					},
+				},
+			},
+		},
+		{
+			"S = sum W : { W > 0, cost(X, W) }.",
+			Aggregate{
+				Func:   "sum",
+				Result: Var{Name: "S"},
+				Term:   Var{Name: "W"},
+				Body: []Evaluable{
+					Atom{
+						Name: "cost",
+						Args: []any{Var{Name: "X"}, Var{Name: "W"}},
+					},
+					Constraint{
+						Op:  ">",
+						Lhs: Var{Name: "W"},
+						Rhs: 0,
+					},
+				},
+			},
+		},
+		{
+			"X = min, foo(X)",
+			Constraint{
+				Op:  "=",
+				Lhs: Var{Name: "X"},
+				Rhs: String("min"),
+			},
+		},
+		{
+			"X = max Y, foo(X)",
+			Constraint{
+				Op:  "=",
+				Lhs: Var{Name: "X"},
+				Rhs: String("max"),
+			},
+		},
+		{
+			"Z = X + Y,",
+			Constraint{
+				Op:  "=",
+				Lhs: Var{Name: "Z"},
+				Rhs: Expr{Op: "+", Lhs: Var{Name: "X"}, Rhs: Var{Name: "Y"}},
+			},
+		},
+		{
+			"D = D0+1.",
+			Constraint{
+				Op:  "=",
+				Lhs: Var{Name: "D"},
+				Rhs: Expr{Op: "+", Lhs: Var{Name: "D0"}, Rhs: 1},
+			},
+		},
+		{
+			"X -1 >= -(Y - 2) * 3 mod 4,",
+			Constraint{
+				Op:  ">=",
+				Lhs: Expr{Op: "-", Lhs: Var{Name: "X"}, Rhs: 1},
+				Rhs: Expr{
+					Op: "mod",
+					Lhs: Expr{
+						Op: "*",
+						Lhs: Expr{
+							Op:  "-",
+							Rhs: Expr{Op: "-", Lhs: Var{Name: "Y"}, Rhs: 2},
+						},
+						Rhs: 3,
+					},
+					Rhs: 4,
+				},
+			},
+		},
+		{
+			"1 + 2 * 3 = X.",
+			Constraint{
+				Op:  "=",
+				Lhs: Expr{Op: "+", Lhs: 1, Rhs: Expr{Op: "*", Lhs: 2, Rhs: 3}},
+				Rhs: Var{Name: "X"},
+			},
+		},
 		{
 			`"aaaa" < "bbbb")`,
 			Constraint{
@@ -176,6 +343,140 @@ func TestParser(t *testing.T) {
 		input    string
 		expected any
 	}{
+		{
+			"foo(a-b, 3-1).",
+			Assertion{
+				Fact: Atom{
+					Name: "foo",
+					Args: []any{String("a-b"), 2},
+				},
+			},
+		},
+		{
+			"at(alice, point(1 + 1, -2)).",
+			Assertion{
+				Fact: Atom{
+					Name: "at",
+					Args: []any{
+						String("alice"),
+						Compound{Functor: "point", Args: []any{2, -2}},
+					},
+				},
+			},
+		},
+		{
+			"lives(bob, address(city(paris), \"75001\"), X).",
+			Assertion{
+				Fact: Atom{
+					Name: "lives",
+					Args: []any{
+						String("bob"),
+						Compound{Functor: "address", Args: []any{
+							Compound{Functor: "city", Args: []any{String("paris")}},
+							String("75001"),
+						}},
+						Var{Name: "X"},
+					},
+				},
+			},
+		},
+		{
+			"next(P, point(X + 1, Y)) :- at(P, point(X, Y)).",
+			Assertion{
+				Fact: Rule{
+					Atom: Atom{
+						Name: "next",
+						Args: []any{
+							Var{Name: "P"},
+							Compound{Functor: "point", Args: []any{Var{Name: "_E0"}, Var{Name: "Y"}}},
+						},
+					},
+					Body: []Evaluable{
+						Atom{
+							Name: "at",
+							Args: []any{
+								Var{Name: "P"},
+								Compound{Functor: "point", Args: []any{Var{Name: "X"}, Var{Name: "Y"}}},
+							},
+						},
+						Constraint{
+							Op:  "=",
+							Lhs: Var{Name: "_E0"},
+							Rhs: Expr{Op: "+", Lhs: Var{Name: "X"}, Rhs: 1},
+						},
+					},
+				},
+			},
+		},
+		{
+			"path(X, Z, [X | P]) :- edge(X, Y), path(Y, Z, P), !member(X, P).",
+			Assertion{
+				Fact: Rule{
+					Atom: Atom{
+						Name: "path",
+						Args: []any{
+							Var{Name: "X"},
+							Var{Name: "Z"},
+							Compound{Functor: ".", Args: []any{Var{Name: "X"}, Var{Name: "P"}}},
+						},
+					},
+					Body: []Evaluable{
+						Atom{Name: "edge", Args: []any{Var{Name: "X"}, Var{Name: "Y"}}},
+						Atom{Name: "path", Args: []any{Var{Name: "Y"}, Var{Name: "Z"}, Var{Name: "P"}}},
+						Negation{Atom: Atom{Name: "member", Args: []any{Var{Name: "X"}, Var{Name: "P"}}}},
+					},
+				},
+			},
+		},
+		{
+			"tags(post, [go, 1 + 1, []]).",
+			Assertion{
+				Fact: Atom{
+					Name: "tags",
+					Args: []any{
+						String("post"),
+						NewList([]any{String("go"), 2, Nil}, nil),
+					},
+				},
+			},
+		},
+		{
+			"price(apple, 0.5).",
+			Assertion{
+				Fact: Atom{
+					Name: "price",
+					Args: []any{String("apple"), Float(0.5)},
+				},
+			},
+		},
+		{
+			"half(X, Y) :- num(X), Y = X / 2.0.",
+			Assertion{
+				Fact: Rule{
+					Atom: Atom{
+						Name: "half",
+						Args: []any{Var{Name: "X"}, Var{Name: "Y"}},
+					},
+					Body: []Evaluable{
+						Atom{Name: "num", Args: []any{Var{Name: "X"}}},
+						Constraint{
+							Op:  "=",
+							Lhs: Var{Name: "Y"},
+							Rhs: Expr{Op: "/", Lhs: Var{Name: "X"}, Rhs: Float(2)},
+						},
+					},
+				},
+			},
+		},
+		{
+			"tags(post, []).",
+			Assertion{
+				Fact: Atom{
+					Name: "tags",
+					Args: []any{String("post"), Nil},
+				},
+			},
+		},
 		{
 			"foo(a).",
 			Assertion{
@@ -269,6 +570,113 @@ func TestParser(t *testing.T) {
 				},
 			},
 		},
+		// arithmetic expressions in the head are replaced with variables
+		{
+			"succ(X, X + 1) :- num(X).",
+			Assertion{
+				Fact: Rule{
+					Atom: Atom{
+						Name: "succ",
+						Args: []any{
+							Var{Name: "X"},
+							Var{Name: "_E0"},
+						},
+					},
+					Body: []Evaluable{
+						Atom{
+							Name: "num",
+							Args: []any{
+								Var{Name: "X"},
+							},
+						},
+						Constraint{
+							Op:  "=",
+							Lhs: Var{Name: "_E0"},
+							Rhs: Expr{Op: "+", Lhs: Var{Name: "X"}, Rhs: 1},
+						},
+					},
+				},
+			},
+		},
+		// constant expressions are evaluated
+		{
+			"foo(2 * (3 + 4), -5).",
+			Assertion{
+				Fact: Atom{
+					Name: "foo",
+					Args: []any{14, -5},
+				},
+			},
+		},
+		{
+			`#input event(source=stdin, format=jsonl, fields="user.id, action", missing=wildcard)`,
+			Input{
+				Name:      "event",
+				Source:    "stdin",
+				Format:    "jsonl",
+				Separator: '\t',
+				Quote:     '"',
+				Fields:    []string{"user.id", "action"},
+				Missing:   "wildcard",
+			},
+		},
+		{
+			`#output ancestor(dest=stdout)`,
+			Output{
+				Name:      "ancestor",
+				Dest:      "stdout",
+				Separator: '\t',
+			},
+		},
+		{
+			`#output ancestor(X, bob, 1 + 1, sep=",")`,
+			Output{
+				Name:      "ancestor",
+				Args:      []any{Var{Name: "X"}, String("bob"), 2},
+				Dest:      "stdout",
+				Separator: ',',
+			},
+		},
+		{
+			"#order sorted",
+			Sorted,
+		},
+		{
+			"#bag",
+			Bag,
+		},
+		{
+			"#set",
+			Set,
+		},
+		{
+			"#table ancestor/2",
+			Table{Name: "ancestor", Arity: 2},
+		},
+		{
+			"#materialize ancestor",
+			Materialize{Name: "ancestor"},
+		},
+		{
+			"#explain path(a, X)",
+			Explain{Atom{Name: "path", Args: []any{String("a"), Var{Name: "X"}}}},
+		},
+		{
+			"#explain path(a, X)?",
+			Explain{Atom{Name: "path", Args: []any{String("a"), Var{Name: "X"}}}},
+		},
+		{
+			"#why ancestor(a, d)?",
+			Why{Atom{Name: "ancestor", Args: []any{String("a"), String("d")}}},
+		},
+		{
+			"#index edge(_, +)",
+			Index{Name: "edge", Arity: 2, Positions: []int{1}},
+		},
+		{
+			"#index triple(+, _, +)",
+			Index{Name: "triple", Arity: 3, Positions: []int{0, 2}},
+		},
 	}
 
 	for _, tt := range testCases {
@@ -7,6 +7,12 @@ import (
 )
 
 func (parser *Parser) readToken() (string, error) {
+	if n := len(parser.buffer); n > 0 {
+		token := parser.buffer[n-1]
+		parser.buffer = parser.buffer[:n-1]
+		return token, nil
+	}
+
 	var str strings.Builder
 LOOP:
 	for {
@@ -30,7 +36,17 @@ LOOP:
 		}
 
 		switch r {
-		case '.', '?', '~', '(', ')', '=', ',', '&':
+		case '.', '?', '~', '(', ')', '=', ',', '&', '{', '}', '*', '/', '[', ']', '|':
+			if s := str.String(); r == '.' && isMantissa(s) && !strings.Contains(s, ".") {
+				// decimal point of a number, like 3.14
+				if next, err := parser.Peek(1); err == nil && isDigit(next[0]) {
+					str.WriteRune(r)
+					continue
+				}
+				// it cannot be unread after peeking, so it is pushed back as a token
+				parser.unreadTokens(string(r))
+				break LOOP
+			}
 			if str.Len() == 0 {
 				str.WriteRune(r)
 			} else {
@@ -66,6 +82,28 @@ LOOP:
 				}
 			}
 			break LOOP
+		case '+', '-':
+			if str.Len() == 0 {
+				str.WriteRune(r)
+				// sign of a number
+				if next, err := parser.Peek(1); err == nil && unicode.IsDigit(rune(next[0])) {
+					continue
+				}
+			} else if s := str.String(); isMantissa(s[:len(s)-1]) && (s[len(s)-1] == 'e' || s[len(s)-1] == 'E') {
+				// sign of the exponent, like in 1.5e-3
+				str.WriteRune(r)
+				continue
+			} else if isIdentifier(s) {
+				// part of the constant, like in a-b
+				str.WriteRune(r)
+				continue
+			} else {
+				// unread, this is a next token
+				if err = parser.UnreadRune(); err != nil {
+					return "", err
+				}
+			}
+			break LOOP
 		case '%':
 			if err := parser.skipLine(); err != nil {
 				return "", err
@@ -89,6 +127,39 @@ LOOP:
 	return str.String(), nil
 }
 
+// Push the tokens back, so they are returned by the following
+// readToken calls in the same order.
+func (parser *Parser) unreadTokens(tokens ...string) {
+	for i := len(tokens) - 1; i >= 0; i-- {
+		parser.buffer = append(parser.buffer, tokens[i])
+	}
+}
+
+// Skip the character if it is the next one on the current line, ignoring
+// the spaces before it. Unlike readToken, it does not wait for the next line.
+func (parser *Parser) skipOnLine(expected rune) error {
+	if n := len(parser.buffer); n > 0 {
+		if parser.buffer[n-1] == string(expected) {
+			parser.buffer = parser.buffer[:n-1]
+		}
+		return nil
+	}
+	for {
+		r, _, err := parser.ReadRune()
+		switch {
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		case r == ' ' || r == '\t':
+			continue
+		case r != expected:
+			return parser.UnreadRune()
+		}
+		return nil
+	}
+}
+
 func (parser *Parser) maybeRead(expected rune, str *strings.Builder) error {
 	r, _, err := parser.ReadRune()
 	if err != nil && err != io.EOF {
@@ -135,6 +206,25 @@ func (parser *Parser) readString() (string, error) {
 	}
 }
 
+// The string is a number without the exponent, like -3 or 3.14.
+func isMantissa(s string) bool {
+	if len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		s = s[1:]
+	}
+	integer, fraction, _ := strings.Cut(s, ".")
+	if len(integer) == 0 {
+		return false
+	}
+	for _, part := range []string{integer, fraction} {
+		for i := 0; i < len(part); i++ {
+			if !isDigit(part[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func (parser *Parser) skipLine() error {
 	for {
 		r, _, err := parser.ReadRune()
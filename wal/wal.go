@@ -0,0 +1,344 @@
+// Package wal implements the write-ahead log for the database.
+//
+// The log directory contains two files: the snapshot of the database
+// saved with Database.WriteTo, and the log of all the changes made
+// since the snapshot was taken, one JSON object per line:
+//
+//	{"assert":{"atom":{"name":"foo","args":[{"str":"a"}]}}}
+//	{"retract":{"atom":{"name":"foo","args":[{"str":"a"}]}}}
+//
+// When the log is opened, the database is rebuilt by loading the snapshot
+// and replaying the changes. Periodically, the log is compacted by saving
+// a new snapshot and truncating the log.
+package wal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/twolodzko/datalogo/datalog"
+)
+
+const (
+	SnapshotFile = "snapshot.dl"
+	LogFile      = "wal.log"
+)
+
+// Sync policy decides when the log is flushed to the disk with fsync.
+type Sync int
+
+const (
+	// Flush after every change, the safest, but the slowest.
+	SyncAlways Sync = iota
+	// Flush periodically, the changes made since the last flush
+	// can be lost in case of a crash.
+	SyncInterval
+	// Leave flushing to the operating system.
+	SyncNever
+)
+
+type Options struct {
+	Sync Sync
+	// How often to flush the log when using SyncInterval,
+	// one second by default.
+	Interval time.Duration
+	// Compact the log after this many changes, zero disables the compaction.
+	CompactEvery int
+}
+
+// Log is a write-ahead log, implements datalog.Journal.
+type Log struct {
+	dir     string
+	db      *datalog.Database
+	opts    Options
+	mu      sync.Mutex
+	file    *os.File
+	writer  *bufio.Writer
+	entries int
+	dirty   bool
+	done    chan struct{}
+}
+
+type entry struct {
+	Assert  json.RawMessage `json:"assert,omitempty"`
+	Retract json.RawMessage `json:"retract,omitempty"`
+}
+
+// Open the log in the directory, creating it if needed, rebuild the database
+// from the snapshot and the log, and start recording the database's changes.
+func Open(dir string, db *datalog.Database, opts Options) (*Log, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := loadSnapshot(filepath.Join(dir, SnapshotFile), db); err != nil {
+		return nil, err
+	}
+	entries, size, err := replay(filepath.Join(dir, LogFile), db)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, LogFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	// drop the torn last line, so the next changes are not appended to it
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return nil, err
+	}
+	l := &Log{
+		dir:     dir,
+		db:      db,
+		opts:    opts,
+		file:    file,
+		writer:  bufio.NewWriter(file),
+		entries: entries,
+		done:    make(chan struct{}),
+	}
+	if opts.Sync == SyncInterval {
+		if l.opts.Interval <= 0 {
+			l.opts.Interval = time.Second
+		}
+		go l.syncPeriodically()
+	}
+	db.Journal = l
+	return l, nil
+}
+
+func loadSnapshot(path string, db *datalog.Database) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = db.ReadFrom(file)
+	return err
+}
+
+// Apply all the changes from the log to the database, return the number
+// of the changes and the size of the complete lines of the log.
+func replay(path string, db *datalog.Database) (int, int64, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	var (
+		reader = bufio.NewReader(file)
+		count  int
+		size   int64
+	)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// the last line without the newline was
+			// not fully written before a crash
+			return count, size, nil
+		}
+		if err != nil {
+			return count, size, err
+		}
+		count++
+
+		var e entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return count, size, fmt.Errorf("%s line %d: %w", path, count, err)
+		}
+		if err := apply(e, db); err != nil {
+			return count, size, fmt.Errorf("%s line %d: %w", path, count, err)
+		}
+		size += int64(len(line))
+	}
+}
+
+func apply(e entry, db *datalog.Database) error {
+	switch {
+	case e.Assert != nil:
+		val, err := datalog.UnmarshalClause(e.Assert)
+		if err != nil {
+			return err
+		}
+		return db.Assert(val)
+	case e.Retract != nil:
+		val, err := datalog.UnmarshalClause(e.Retract)
+		if err != nil {
+			return err
+		}
+		atom, ok := val.(datalog.Atom)
+		if !ok {
+			return fmt.Errorf("%v cannot be retracted", val)
+		}
+		return db.Remove(atom)
+	default:
+		return fmt.Errorf("empty entry")
+	}
+}
+
+// Append the Assertion or Retraction to the log.
+func (l *Log) Record(change any) error {
+	var (
+		e   entry
+		err error
+	)
+	switch change := change.(type) {
+	case datalog.Assertion:
+		val, ok := change.Fact.(datalog.HasKey)
+		if !ok {
+			return fmt.Errorf("%v cannot be stored in database", change.Fact)
+		}
+		e.Assert, err = datalog.MarshalClause(val)
+	case datalog.Retraction:
+		e.Retract, err = datalog.MarshalClause(change.Fact)
+	default:
+		return fmt.Errorf("%v cannot be recorded", change)
+	}
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// the change is recorded before it is applied to the database,
+	// so it is not a part of the snapshot and goes to the new log
+	if l.opts.CompactEvery > 0 && l.entries >= l.opts.CompactEvery {
+		if err := l.compact(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := l.writer.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	l.entries++
+	l.dirty = true
+	if l.opts.Sync == SyncAlways {
+		return l.sync()
+	}
+	return l.writer.Flush()
+}
+
+// Save the snapshot of the database and truncate the log.
+func (l *Log) Compact() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.compact()
+}
+
+func (l *Log) compact() error {
+	// write to a temporary file and rename it, so that there
+	// is always a complete snapshot, even in case of a crash
+	path := filepath.Join(l.dir, SnapshotFile)
+	tmp, err := os.CreateTemp(l.dir, SnapshotFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	if _, err := l.db.WriteTo(writer); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	if err := syncDir(l.dir); err != nil {
+		return err
+	}
+
+	// the snapshot contains all the changes, so the log can be cleared
+	if err := l.writer.Flush(); err != nil {
+		return err
+	}
+	if err := l.file.Truncate(0); err != nil {
+		return err
+	}
+	l.entries = 0
+	return l.sync()
+}
+
+// Flush the buffered changes and fsync the log file.
+func (l *Log) sync() error {
+	if err := l.writer.Flush(); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.dirty = false
+	return nil
+}
+
+func (l *Log) syncPeriodically() {
+	ticker := time.NewTicker(l.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.mu.Lock()
+			if l.dirty {
+				// there is nobody to report the error to,
+				// it will surface on the next write
+				_ = l.sync()
+			}
+			l.mu.Unlock()
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// Flush the log, stop recording the changes of the database, and close the file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	close(l.done)
+	if l.db.Journal == l {
+		l.db.Journal = nil
+	}
+	if err := l.sync(); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,126 @@
+package wal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	. "github.com/twolodzko/datalogo/datalog"
+)
+
+func query(t *testing.T, db *Database, query Atom) []Atom {
+	out := make(chan Result)
+	if err := db.Query(query, out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var results []Atom
+	for result := range out {
+		if result.Err != nil {
+			t.Fatalf("unexpected error: %s", result.Err)
+		}
+		results = append(results, result.Atom)
+	}
+	return results
+}
+
+func open(t *testing.T, dir string, opts Options) (*Database, *Log) {
+	db := NewDatabase()
+	log, err := Open(dir, db, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return db, log
+}
+
+func TestReplay(t *testing.T) {
+	for _, compactEvery := range []int{0, 2} {
+		dir := t.TempDir()
+
+		db, log := open(t, dir, Options{CompactEvery: compactEvery})
+		for _, val := range []HasKey{
+			Atom{Name: "foo", Args: []any{String("a")}},
+			Atom{Name: "foo", Args: []any{String("b")}},
+			Atom{Name: "foo", Args: []any{String("c")}},
+			Rule{
+				Atom: Atom{Name: "bar", Args: []any{Var{Name: "X"}}},
+				Body: []Evaluable{Atom{Name: "foo", Args: []any{Var{Name: "X"}}}},
+			},
+		} {
+			if err := db.Assert(val); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		if err := db.Remove(Atom{Name: "foo", Args: []any{String("b")}}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := log.Close(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		db, log = open(t, dir, Options{CompactEvery: compactEvery})
+		defer log.Close()
+
+		result := query(t, db, Atom{Name: "bar", Args: []any{String("b")}})
+		if len(result) != 0 {
+			t.Errorf("expected the retracted fact to stay removed, got: %v", result)
+		}
+		result = query(t, db, Atom{Name: "bar", Args: []any{String("c")}})
+		expected := []Atom{{Name: "bar", Args: []any{String("c")}}}
+		if !cmp.Equal(result, expected) {
+			t.Errorf("expected %v, got %v", expected, result)
+		}
+
+		if compactEvery > 0 {
+			if _, err := os.Stat(filepath.Join(dir, SnapshotFile)); err != nil {
+				t.Errorf("expected the snapshot to be saved: %s", err)
+			}
+		}
+	}
+}
+
+func TestTornLastLine(t *testing.T) {
+	dir := t.TempDir()
+	entries := `{"assert":{"atom":{"name":"foo","args":[{"int":1}]}}}
+{"assert":{"atom":{"name":"foo","args":[{"int":2}]}}}
+{"assert":{"atom":{"name":"fo`
+	if err := os.WriteFile(filepath.Join(dir, LogFile), []byte(entries), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	db, log := open(t, dir, Options{})
+	result := query(t, db, Atom{Name: "foo", Args: []any{Var{Name: "X"}}})
+	if len(result) != 2 {
+		t.Errorf("expected two facts, got: %v", result)
+	}
+
+	// the change is not appended to the torn line
+	if err := db.Assert(Atom{Name: "foo", Args: []any{3}}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	db, log = open(t, dir, Options{})
+	defer log.Close()
+
+	result = query(t, db, Atom{Name: "foo", Args: []any{Var{Name: "X"}}})
+	if len(result) != 3 {
+		t.Errorf("expected three facts, got: %v", result)
+	}
+}
+
+func TestInvalidEntry(t *testing.T) {
+	dir := t.TempDir()
+	entries := `{"assert":{"atom":{"name":"foo","args":[{"int":1}]}}}
+{"retract":{"rule":{"head":{"name":"foo","args":[]},"body":[]}}}
+`
+	if err := os.WriteFile(filepath.Join(dir, LogFile), []byte(entries), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err := Open(dir, NewDatabase(), Options{})
+	if err == nil {
+		t.Error("expected an error")
+	}
+}